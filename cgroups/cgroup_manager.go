@@ -2,6 +2,7 @@ package cgroups
 
 import (
 	"Mydockker/cgroups/subsystems"
+	"Mydockker/container"
 	"Mydockker/meta"
 	"fmt"
 )
@@ -13,6 +14,25 @@ import (
  * 3.删除 subsystem 约束；
  */
 
+/**
+ * Manager 屏蔽 cgroup v1/v2 的差异
+ */
+type Manager interface {
+	Apply(pid int, conf *subsystems.ResourceConfig) error
+	Set(conf *subsystems.ResourceConfig) error
+	Destory() error
+}
+
+/**
+ * 宿主机挂载 cgroup v2 或 rootless 模式下使用 CgroupV2Manager
+ */
+func NewManager(path string) Manager {
+	if IsCgroupV2() || container.IsRootless() {
+		return NewCgroupV2Manager(path)
+	}
+	return NewCgroupManger(path)
+}
+
 type CgroupManager struct {
 	Path     string
 	Resource *subsystems.ResourceConfig
@@ -0,0 +1,228 @@
+package cgroups
+
+import (
+	"Mydockker/cgroups/subsystems"
+	"Mydockker/container"
+	"Mydockker/meta"
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/**
+ * CgroupV2Manager 管理 cgroup v2 统一层级下的资源限制
+ * rootless 模式下只能使用 systemd 委派给当前用户的子树（user@${uid}.service）
+ */
+
+const (
+	cgroupV2Root        = "/sys/fs/cgroup"
+	cgroupV2Controllers = "cgroup.controllers"
+	cgroupV2Subtree     = "cgroup.subtree_control"
+	cgroupV2Procs       = "cgroup.procs"
+	procSelfCgroup      = "/proc/self/cgroup"
+)
+
+type CgroupV2Manager struct {
+	Path     string
+	Resource *subsystems.ResourceConfig
+}
+
+func NewCgroupV2Manager(path string) *CgroupV2Manager {
+	return &CgroupV2Manager{
+		Path: path,
+	}
+}
+
+/**
+ * 判断宿主机是否挂载 cgroup v2 统一层级
+ */
+func IsCgroupV2() bool {
+	_, err := os.Stat(path.Join(cgroupV2Root, cgroupV2Controllers))
+	return err == nil
+}
+
+/**
+ * 添加进程到 cgroup 节点
+ */
+func (c *CgroupV2Manager) Apply(pid int, conf *subsystems.ResourceConfig) error {
+	cgroupPath, err := c.absPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cgroupPath, container.Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("CgroupV2Manager::Apply mkdir %s failed", cgroupPath), err)
+	}
+	if err := ioutil.WriteFile(path.Join(cgroupPath, cgroupV2Procs), []byte(strconv.Itoa(pid)), container.Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("CgroupV2Manager::Apply add pid %d failed", pid), err)
+	}
+	return nil
+}
+
+/**
+ * 更新 Cgroups 资源配置
+ * 1.沿路径逐级开启需要的 controller；
+ * 2.写入 memory.max、cpu.max、cpu.weight、cpuset.cpus；
+ */
+func (c *CgroupV2Manager) Set(conf *subsystems.ResourceConfig) error {
+	root, err := delegatedRoot()
+	if err != nil {
+		return err
+	}
+	cgroupPath := path.Join(root, c.Path)
+	if err := os.MkdirAll(cgroupPath, container.Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("CgroupV2Manager::Set mkdir %s failed", cgroupPath), err)
+	}
+	files := map[string]string{}
+	controllers := make([]string, 0, 3)
+	if conf.MemoryLimit != "" {
+		limit, err := parseMemoryLimit(conf.MemoryLimit)
+		if err != nil {
+			return err
+		}
+		files["memory.max"] = limit
+		controllers = append(controllers, "memory")
+	}
+	if conf.CpuCfsQuota != 0 || conf.CpuShare != "" {
+		if conf.CpuCfsQuota != 0 {
+			quota := subsystems.CPU_DEFAULT_PERIOD / subsystems.CPU_DEFAULT_PERCENT * conf.CpuCfsQuota
+			files["cpu.max"] = fmt.Sprintf("%d %d", quota, subsystems.CPU_DEFAULT_PERIOD)
+		}
+		if conf.CpuShare != "" {
+			shares, err := strconv.ParseUint(conf.CpuShare, 10, 64)
+			if err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CGROUPS), fmt.Sprintf("invalid cpu shares %s", conf.CpuShare), err)
+			}
+			files["cpu.weight"] = strconv.FormatUint(convertSharesToWeight(shares), 10)
+		}
+		controllers = append(controllers, "cpu")
+	}
+	if conf.CpuSet != "" {
+		files["cpuset.cpus"] = conf.CpuSet
+		controllers = append(controllers, "cpuset")
+	}
+	if err := enableControllers(root, c.Path, controllers); err != nil {
+		return err
+	}
+	for name, value := range files {
+		if err := ioutil.WriteFile(path.Join(cgroupPath, name), []byte(value), container.Perm0644); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("CgroupV2Manager::Set %s failed", name), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * 销毁 cgroup 节点
+ */
+func (c *CgroupV2Manager) Destory() error {
+	cgroupPath, err := c.absPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(cgroupPath); err != nil && !os.IsNotExist(err) {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("CgroupV2Manager::Destory remove %s failed", cgroupPath), err)
+	}
+	return nil
+}
+
+func (c *CgroupV2Manager) absPath() (string, error) {
+	root, err := delegatedRoot()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(root, c.Path), nil
+}
+
+/**
+ * 可写的 cgroup v2 根节点
+ * root 用户使用 /sys/fs/cgroup，rootless 模式使用当前进程所属的 user@${uid}.service 子树
+ * for example: 0::/user.slice/user-1000.slice/user@1000.service/app.slice/xxx.scope
+ */
+func delegatedRoot() (string, error) {
+	if !container.IsRootless() {
+		return cgroupV2Root, nil
+	}
+	f, err := os.Open(procSelfCgroup)
+	if err != nil {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CGROUPS), "read /proc/self/cgroup failed", err)
+	}
+	defer f.Close()
+	delegate := fmt.Sprintf("user@%d.service", os.Getuid())
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		cgroupPath := strings.TrimPrefix(line, "0::")
+		idx := strings.Index(cgroupPath, delegate)
+		if idx < 0 {
+			break
+		}
+		return path.Join(cgroupV2Root, cgroupPath[:idx+len(delegate)]), nil
+	}
+	return "", meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CGROUPS), fmt.Sprintf("no delegated cgroup v2 subtree %s", delegate), nil)
+}
+
+/**
+ * 从根节点到目标节点的父节点逐级写入 cgroup.subtree_control
+ */
+func enableControllers(root, cgroupPath string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+	available, err := ioutil.ReadFile(path.Join(root, cgroupV2Controllers))
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CGROUPS), "read cgroup.controllers failed", err)
+	}
+	for _, controller := range controllers {
+		if !strings.Contains(" "+strings.TrimSpace(string(available))+" ", " "+controller+" ") {
+			return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CGROUPS), fmt.Sprintf("controller %s is not delegated", controller), nil)
+		}
+	}
+	current := root
+	for _, part := range strings.Split(path.Clean(cgroupPath), "/") {
+		for _, controller := range controllers {
+			if err := ioutil.WriteFile(path.Join(current, cgroupV2Subtree), []byte("+"+controller), container.Perm0644); err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CGROUPS), fmt.Sprintf("enable controller %s in %s failed", controller, current), err)
+			}
+		}
+		current = path.Join(current, part)
+	}
+	return nil
+}
+
+/**
+ * 转换内存限制，例如 100m -> 104857600
+ */
+func parseMemoryLimit(limit string) (string, error) {
+	limit = strings.ToLower(strings.TrimSpace(limit))
+	if limit == "max" || limit == "-1" {
+		return "max", nil
+	}
+	units := map[byte]uint64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}
+	multiplier := uint64(1)
+	if unit, ok := units[limit[len(limit)-1]]; ok {
+		multiplier = unit
+		limit = limit[:len(limit)-1]
+	}
+	value, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CGROUPS), fmt.Sprintf("invalid memory limit %s", limit), err)
+	}
+	return strconv.FormatUint(value*multiplier, 10), nil
+}
+
+/**
+ * cpu.shares [2, 262144] 转换为 cpu.weight [1, 10000]
+ */
+func convertSharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
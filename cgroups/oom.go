@@ -0,0 +1,44 @@
+package cgroups
+
+import (
+	"Mydockker/cgroups/subsystems"
+	"Mydockker/container"
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/**
+ * cgroup 内因 OOM 被杀死的进程数
+ * v2 读取 memory.events 的 oom_kill，v1 读取 memory.oom_control 的 oom_kill（内核 4.13 起）
+ */
+func OOMKillCount(cgroupPath string) (int, error) {
+	var file string
+	if IsCgroupV2() || container.IsRootless() {
+		absPath, err := NewCgroupV2Manager(cgroupPath).absPath()
+		if err != nil {
+			return 0, err
+		}
+		file = path.Join(absPath, "memory.events")
+	} else {
+		absPath, err := subsystems.MemoryCgroupPath(cgroupPath)
+		if err != nil {
+			return 0, err
+		}
+		file = path.Join(absPath, "memory.oom_control")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CGROUPS), fmt.Sprintf("read %s failed", file), err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.Atoi(fields[1])
+		}
+	}
+	return 0, nil
+}
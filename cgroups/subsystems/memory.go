@@ -67,3 +67,8 @@ func (m *MemorySubsystem) Remove(cgroupPath string) error {
 	}
 	return nil
 }
+
+// memory 子系统下 cgroup 的绝对路径
+func MemoryCgroupPath(cgroupPath string) (string, error) {
+	return getCgroupPath((&MemorySubsystem{}).Name(), cgroupPath, false)
+}
@@ -26,7 +26,8 @@ func getCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string
 	}
 	_, err := os.Stat(absPath)
 	if err != nil && os.IsNotExist(err) {
-		err = os.Mkdir(absPath, container.Perm0755)
+		// pod containers are nested under cgroup of pod
+		err = os.MkdirAll(absPath, container.Perm0755)
 		return absPath, err
 	}
 	return absPath, nil
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"Mydockker/container"
+	"Mydockker/logger"
+	"Mydockker/meta"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+/**
+ * 全局配置
+ * 1.--config 指定配置文件，未指定时依次查找 /etc/mydocker/config.toml、/etc/mydocker/config.json，都不存在时使用默认值；
+ * 2.--root、--state 覆盖配置文件中的 root、state；
+ * 3.run 未指定 --log-driver、--net 时使用配置中的 log-driver、log-opts、default-network，default-ulimits 可被 --ulimit 覆盖；
+ * Usage: ./Mydocker --root /data/mydocker --state /run/mydocker run -d busybox top
+ *
+ * config.toml 示例：
+ *   root = "/data/mydocker"
+ *   default-network = "testnet"
+ *   default-ulimits = ["nofile=65536:65536"]
+ *   log-driver = "json-file"
+ *   [log-opts]
+ *   max-size = "10m"
+ */
+
+var DefaultConfigFiles = []string{"/etc/mydocker/config.toml", "/etc/mydocker/config.json"}
+
+const (
+	StorageDriverOverlay2 = "overlay2"
+	CgroupDriverCgroupfs  = "cgroupfs"
+)
+
+const (
+	defaultRoot  = "/root/"
+	defaultState = "/home/root/goproject/Mydocker/"
+	// 未指定 state 时网络配置和 IPAM 仍位于 /var/run 下
+	defaultNetworkDir = "/var/run/Mydocker/network/"
+)
+
+type Config struct {
+	Root           string            `json:"root"`            //镜像和容器工作目录
+	State          string            `json:"state"`           //容器记录、日志、pod 记录
+	StorageDriver  string            `json:"storage-driver"`  //存储驱动，目前只支持 overlay2
+	CgroupDriver   string            `json:"cgroup-driver"`   //cgroup 驱动，目前只支持 cgroupfs
+	DefaultNetwork string            `json:"default-network"` //run 未指定 --net 时连接的网络
+	LogDriver      string            `json:"log-driver"`      //默认日志驱动
+	LogOpts        map[string]string `json:"log-opts"`        //默认日志驱动选项
+	DefaultUlimits []string          `json:"default-ulimits"` //默认 ulimit，格式同 --ulimit
+}
+
+/**
+ * 默认配置，rootless 模式下 state 位于 $XDG_RUNTIME_DIR，root 位于 $XDG_DATA_HOME
+ */
+func Default() *Config {
+	root, state := defaultRoot, defaultState
+	if container.IsRootless() {
+		root, state = rootlessDirs()
+	}
+	return &Config{
+		Root:          root,
+		State:         state,
+		StorageDriver: StorageDriverOverlay2,
+		CgroupDriver:  CgroupDriverCgroupfs,
+		LogDriver:     logger.DriverJSONFile,
+	}
+}
+
+func rootlessDirs() (string, string) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = path.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return path.Join(dataDir, "mydocker") + "/", path.Join(runtimeDir, "mydocker") + "/"
+}
+
+/**
+ * 读取配置文件，file 为空时查找默认配置文件，未找到时返回默认配置
+ * 配置文件中未出现的项保持默认值
+ */
+func Load(file string) (*Config, error) {
+	cfg := Default()
+	files := DefaultConfigFiles
+	if file != "" {
+		files = []string{file}
+	}
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			if os.IsNotExist(err) && file == "" {
+				continue
+			}
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.META), fmt.Sprintf("read config file %s failed", f), err)
+		}
+		if err := decode(f, content, cfg); err != nil {
+			return nil, err
+		}
+		break
+	}
+	return cfg, nil
+}
+
+/**
+ * .json 按 json 解析，其余按 toml 解析，未知的配置项报错
+ */
+func decode(file string, content []byte, cfg *Config) error {
+	if filepath.Ext(file) != ".json" {
+		values, err := parseTOML(string(content))
+		if err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.META), fmt.Sprintf("parse config file %s failed", file), err)
+		}
+		if content, err = json.Marshal(values); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.META), fmt.Sprintf("parse config file %s failed", file), err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.META), fmt.Sprintf("parse config file %s failed", file), err)
+	}
+	return nil
+}
+
+/**
+ * 校验配置，命令行参数覆盖后调用
+ */
+func (c *Config) Validate() error {
+	for name, dir := range map[string]string{"root": c.Root, "state": c.State} {
+		if !filepath.IsAbs(dir) {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.META), fmt.Sprintf("%s directory %q should be an absolute path", name, dir), nil)
+		}
+	}
+	if c.StorageDriver != StorageDriverOverlay2 {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.META), fmt.Sprintf("unsupported storage driver %s, only %s is supported", c.StorageDriver, StorageDriverOverlay2), nil)
+	}
+	if c.CgroupDriver != CgroupDriverCgroupfs {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.META), fmt.Sprintf("unsupported cgroup driver %s, only %s is supported", c.CgroupDriver, CgroupDriverCgroupfs), nil)
+	}
+	if err := logger.ValidateLogConfig(c.LogDriver, c.LogOpts); err != nil {
+		return err
+	}
+	_, err := container.ParseUlimits(c.DefaultUlimits)
+	return err
+}
+
+/**
+ * 网络配置和 IPAM 所在目录，指定 state 时位于 state 下
+ */
+func (c *Config) NetworkDir() string {
+	if filepath.Clean(c.State) == filepath.Clean(Default().State) {
+		return defaultNetworkDir
+	}
+	return path.Join(c.State, "network") + "/"
+}
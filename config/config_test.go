@@ -0,0 +1,92 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadTOML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	content := `# mydocker daemon defaults
+root = "/data/mydocker"
+default-network = "testnet"
+default-ulimits = [
+  "nofile=65536:65536", # open files
+  "nproc=1024",
+]
+
+[log-opts]
+max-size = "10m"
+max-file = '3'
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Root != "/data/mydocker" || cfg.DefaultNetwork != "testnet" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.DefaultUlimits, []string{"nofile=65536:65536", "nproc=1024"}) {
+		t.Fatalf("unexpected ulimits %v", cfg.DefaultUlimits)
+	}
+	if !reflect.DeepEqual(cfg.LogOpts, map[string]string{"max-size": "10m", "max-file": "3"}) {
+		t.Fatalf("unexpected log opts %v", cfg.LogOpts)
+	}
+	// unset keys keep defaults
+	if cfg.StorageDriver != StorageDriverOverlay2 || cfg.State != Default().State {
+		t.Fatalf("defaults lost %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unknown.json":   `{"storage": "overlay2"}`,
+		"unknown.toml":   `storage = "overlay2"`,
+		"value.toml":     `root = /data`,
+		"duplicate.toml": "root = \"/a\"\nroot = \"/b\"",
+	} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(file); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing.toml")); err == nil {
+		t.Error("expected error for missing explicit config file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, modify := range []func(*Config){
+		func(c *Config) { c.Root = "relative" },
+		func(c *Config) { c.StorageDriver = "vfs" },
+		func(c *Config) { c.CgroupDriver = "systemd" },
+		func(c *Config) { c.LogDriver = "gelf" },
+		func(c *Config) { c.DefaultUlimits = []string{"nofile"} },
+	} {
+		cfg := Default()
+		modify(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected invalid config %+v", cfg)
+		}
+	}
+}
+
+func TestNetworkDir(t *testing.T) {
+	cfg := Default()
+	cfg.State = "/run/mydocker"
+	if dir := cfg.NetworkDir(); dir != "/run/mydocker/network/" {
+		t.Fatalf("unexpected network dir %s", dir)
+	}
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 解析配置文件用到的 toml 子集
+ * 1.key = value，value 支持字符串、整数、布尔值和数组，数组可以跨行；
+ * 2.[table] 开始一个表，之后的 key 都属于该表，不支持嵌套表；
+ * 3.# 开始的注释；
+ */
+func parseTOML(content string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	current := root
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table %q", lineNo, line)
+			}
+			name, err := parseKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if _, ok := root[name]; ok {
+				return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, name)
+			}
+			current = map[string]interface{}{}
+			root[name] = current
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNo, line)
+		}
+		key, err := parseKey(line[:idx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		raw := strings.TrimSpace(line[idx+1:])
+		// 跨行数组，读到方括号闭合为止
+		for strings.HasPrefix(raw, "[") && !arrayClosed(raw) && i+1 < len(lines) {
+			i++
+			raw += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		value, rest, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %d: unexpected %q after value", lineNo, rest)
+		}
+		if _, ok := current[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+		current[key] = value
+	}
+	return root, nil
+}
+
+func parseKey(s string) (string, error) {
+	key := strings.TrimSpace(s)
+	if len(key) >= 2 && key[0] == '"' && key[len(key)-1] == '"' {
+		return strconv.Unquote(key)
+	}
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return key, nil
+}
+
+/**
+ * 解析一个值，返回剩余未解析的部分
+ */
+func parseValue(s string) (interface{}, string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		end := closingQuote(s)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string %s", s)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		return value, s[end+1:], nil
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case s[0] == '[':
+		values := []interface{}{}
+		rest := strings.TrimSpace(s[1:])
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return values, rest[1:], nil
+			}
+			value, r, err := parseValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			values = append(values, value)
+			rest = strings.TrimSpace(r)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in array, got %q", rest)
+			}
+		}
+	}
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	token := s[:end]
+	switch token {
+	case "true":
+		return true, s[end:], nil
+	case "false":
+		return false, s[end:], nil
+	}
+	n, err := strconv.ParseInt(strings.Replace(token, "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported value %q", token)
+	}
+	return n, s[end:], nil
+}
+
+// closingQuote 返回双引号字符串结束引号的位置，跳过转义字符
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComment 去掉不在字符串中的 # 注释
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func arrayClosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
@@ -0,0 +1,216 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * linux capability 限制
+ * init 进程在 execve 之前将 bounding、effective、permitted 集合收缩为指定集合，inheritable、ambient 保持为空
+ * 默认集合与 docker 保持一致，--privileged 保留全部 capability
+ */
+
+const capLastCapFile = "/proc/sys/kernel/cap_last_cap"
+
+// capability 名称与编号
+var capabilityMap = map[string]uintptr{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// docker 默认 capability 集合
+var DefaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+/**
+ * 计算容器的 capability 集合
+ * 1.privileged 返回全部 capability；
+ * 2.默认集合先移除 --cap-drop，再加入 --cap-add，ALL 表示全部；
+ * Usage: ./Mydocker run --cap-add NET_ADMIN --cap-drop ALL xxx
+ */
+func ResolveCapabilities(capAdd, capDrop []string, privileged bool) ([]string, error) {
+	if privileged {
+		return allCapabilities(), nil
+	}
+	caps := map[string]bool{}
+	for _, c := range DefaultCapabilities {
+		caps[c] = true
+	}
+	for _, c := range capDrop {
+		if strings.ToUpper(c) == "ALL" {
+			caps = map[string]bool{}
+			continue
+		}
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		delete(caps, name)
+	}
+	for _, c := range capAdd {
+		if strings.ToUpper(c) == "ALL" {
+			for _, name := range allCapabilities() {
+				caps[name] = true
+			}
+			continue
+		}
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		caps[name] = true
+	}
+	result := make([]string, 0, len(caps))
+	for name := range caps {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+/**
+ * 统一 capability 名称，例如 net_admin -> CAP_NET_ADMIN
+ */
+func normalizeCapability(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	if _, ok := capabilityMap[name]; !ok {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("unknown capability %s", name), nil)
+	}
+	return name, nil
+}
+
+func allCapabilities() []string {
+	result := make([]string, 0, len(capabilityMap))
+	for name := range capabilityMap {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+/**
+ * 收缩当前进程的 capability 集合
+ * 1.PR_CAPBSET_DROP 移除 bounding 集合，需要 CAP_SETPCAP，所以最先执行；
+ * 2.capset 设置 effective、permitted，inheritable 置空；
+ * inheritable 为空时内核同时清空 ambient，容器内非 root 用户 execve 后不再持有 capability
+ */
+func applyCapabilities(caps []string) error {
+	lastCap := lastCapability()
+	keep, data, err := capabilitySets(caps, lastCap)
+	if err != nil {
+		return err
+	}
+	for c := uintptr(0); c <= lastCap; c++ {
+		if keep[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("drop bounding capability %d failed", c), err)
+		}
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "capset failed", err)
+	}
+	return nil
+}
+
+/**
+ * 计算保留的 bounding 集合与 capset 参数，只设置 effective、permitted
+ */
+func capabilitySets(caps []string, lastCap uintptr) (map[uintptr]bool, [2]unix.CapUserData, error) {
+	keep := map[uintptr]bool{}
+	var data [2]unix.CapUserData
+	for _, name := range caps {
+		c, ok := capabilityMap[name]
+		if !ok {
+			return nil, data, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("unknown capability %s", name), nil)
+		}
+		// 内核不支持的 capability 直接忽略
+		if c > lastCap {
+			continue
+		}
+		keep[c] = true
+		data[c/32].Effective |= 1 << (c % 32)
+		data[c/32].Permitted |= 1 << (c % 32)
+	}
+	return keep, data, nil
+}
+
+/**
+ * 内核支持的最大 capability 编号，可能小于 unix.CAP_LAST_CAP
+ */
+func lastCapability() uintptr {
+	content, err := ioutil.ReadFile(capLastCapFile)
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return uintptr(last)
+}
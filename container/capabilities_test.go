@@ -0,0 +1,50 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestResolveCapabilities(t *testing.T) {
+	caps, err := ResolveCapabilities([]string{"net_admin"}, []string{"ALL"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(caps, []string{"CAP_NET_ADMIN"}) {
+		t.Fatalf("unexpected capabilities %v", caps)
+	}
+	caps, err = ResolveCapabilities(nil, []string{"CAP_MKNOD"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caps) != len(DefaultCapabilities)-1 {
+		t.Fatalf("unexpected capabilities %v", caps)
+	}
+	if _, err = ResolveCapabilities([]string{"CAP_UNKNOWN"}, nil, false); err == nil {
+		t.Fatal("expected unknown capability error")
+	}
+	caps, _ = ResolveCapabilities(nil, []string{"ALL"}, true)
+	if len(caps) != len(capabilityMap) {
+		t.Fatalf("privileged should keep all capabilities, got %d", len(caps))
+	}
+}
+
+func TestCapabilitySetsNotInheritable(t *testing.T) {
+	keep, data, err := capabilitySets(DefaultCapabilities, unix.CAP_LAST_CAP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keep) != len(DefaultCapabilities) {
+		t.Fatalf("unexpected bounding set %v", keep)
+	}
+	for _, d := range data {
+		if d.Inheritable != 0 {
+			t.Fatalf("inheritable set should be empty, got %#x", d.Inheritable)
+		}
+	}
+	if data[0].Effective&(1<<unix.CAP_NET_RAW) == 0 || data[0].Permitted&(1<<unix.CAP_NET_RAW) == 0 {
+		t.Fatal("CAP_NET_RAW should be effective and permitted")
+	}
+}
@@ -3,22 +3,138 @@ package container
 import (
 	"Mydockker/meta"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
 )
 
+// suffix of image tarball being written by commit
+const imageTmpSuffix = ".tmp"
+
 /**
- * commit and tar container fileSystem to ${imageName}.tar
+ * commit and tar container fileSystem to images/${imageName}.tar, labels are saved in images/${imageName}.json
  */
-func Commit(containerName, imageName string) error {
-	mntUrl := getMerged(containerName)
-	imageUrl := getImage(imageName)
+func Commit(paths *Paths, info *Info, imageName string, labels map[string]string) error {
+	containerName := info.Name
+	mntUrl := paths.merged(containerName)
+	if IsRootless() {
+		rootUrl, err := getRootlessMerged(info)
+		if err != nil {
+			return err
+		}
+		mntUrl = rootUrl
+	}
+	imageUrl := paths.ImagePath(imageName)
 	_, err := os.Stat(imageUrl)
 	if err == nil {
 		return fmt.Errorf("file %s already exists", imageUrl)
 	}
-	if _, err := exec.Command("tar", "-zcf", imageUrl, "-C", mntUrl, ".").CombinedOutput(); err != nil {
+	if err := os.MkdirAll(paths.ImageRoot(), Perm0755); err != nil {
+		return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir image dir %s failed", paths.ImageRoot()), err)
+	}
+	// tar into a locked temporary file first, an interrupted commit never leaves a truncated image
+	// and prune never removes the temporary file of a running commit
+	tmpUrl := paths.imageTmpPath(imageName)
+	tmpFile, err := lockImageTmp(tmpUrl)
+	if err != nil {
+		return err
+	}
+	defer tmpFile.Close()
+	cmd := exec.Command("tar", "-zcf", "-", "-C", mntUrl, ".")
+	cmd.Stdout = tmpFile
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpUrl)
 		return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("tar folder %s failed", imageUrl), err)
 	}
+	if err := writeImageMeta(paths, imageName, containerName, labels); err != nil {
+		os.Remove(tmpUrl)
+		return err
+	}
+	if err := os.Rename(tmpUrl, imageUrl); err != nil {
+		os.Remove(tmpUrl)
+		return meta.NewError(meta.ErrWrite, fmt.Sprintf("rename image %s failed", imageUrl), err)
+	}
 	return nil
 }
+
+/**
+ * create and lock temporary file of a commit, the lock is held until the file is closed
+ */
+func lockImageTmp(tmpUrl string) (*os.File, error) {
+	file, err := os.OpenFile(tmpUrl, os.O_CREATE|os.O_WRONLY, Perm0644)
+	if err != nil {
+		return nil, meta.NewError(meta.ErrWrite, fmt.Sprintf("create image file %s failed", tmpUrl), err)
+	}
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		file.Close()
+		return nil, meta.NewError(meta.ErrWrite, fmt.Sprintf("image %s is being committed", tmpUrl), err)
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, meta.NewError(meta.ErrWrite, fmt.Sprintf("truncate image file %s failed", tmpUrl), err)
+	}
+	return file, nil
+}
+
+/**
+ * whether the temporary file is locked by a running commit
+ */
+func commitInProgress(tmpUrl string) bool {
+	file, err := os.Open(tmpUrl)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return unix.Flock(int(file.Fd()), unix.LOCK_SH|unix.LOCK_NB) == unix.EWOULDBLOCK
+}
+
+/**
+ * dangling image files under image dir: tarballs of interrupted commits and metadata whose tarball is gone
+ * files of a running commit are skipped, nothing outside image dir is touched
+ */
+func DanglingImages(paths *Paths) ([]string, error) {
+	imageRoot := paths.ImageRoot()
+	entries, err := ioutil.ReadDir(imageRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read image dir %s failed", imageRoot), err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, imageTmpSuffix) {
+			if !commitInProgress(path.Join(imageRoot, name)) {
+				files = append(files, path.Join(imageRoot, name))
+			}
+			continue
+		}
+		if imageName := strings.TrimSuffix(name, ".json"); imageName != name {
+			if commitInProgress(paths.imageTmpPath(imageName)) {
+				continue
+			}
+			if _, err := os.Stat(paths.ImagePath(imageName)); os.IsNotExist(err) {
+				files = append(files, path.Join(imageRoot, name))
+			}
+		}
+	}
+	return files, nil
+}
+
+/**
+ * rootless overlayfs only exists in container's mount namespace, reach it by /proc/${pid}/root
+ */
+func getRootlessMerged(info *Info) (string, error) {
+	if info.Status != RUNNING || strings.TrimSpace(info.Pid) == "" {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), "rootless commit requires a running container", nil)
+	}
+	return fmt.Sprintf("/proc/%s/root", info.Pid), nil
+}
@@ -0,0 +1,60 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDanglingImages(t *testing.T) {
+	paths := NewPaths(t.TempDir(), t.TempDir())
+	// files of other programs sharing root dir
+	for _, name := range []string{"foo.json", "foo.tmp"} {
+		if err := ioutil.WriteFile(filepath.Join(paths.Root, name), []byte("{}"), Perm0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(paths.ImageRoot(), Perm0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"busybox.tar":     "",
+		"busybox.json":    "{}",
+		"orphan.json":     "{}",
+		"broken.tar.tmp":  "",
+		"running.json":    "{}",
+		"running.tar.tmp": "",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(paths.ImageRoot(), name), []byte(content), Perm0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// commit of image running holds lock of its temporary file
+	tmpFile, err := lockImageTmp(paths.imageTmpPath("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpFile.Close()
+
+	dangling, err := DanglingImages(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(dangling)
+	expected := []string{
+		filepath.Join(paths.ImageRoot(), "broken.tar.tmp"),
+		filepath.Join(paths.ImageRoot(), "orphan.json"),
+	}
+	if !reflect.DeepEqual(dangling, expected) {
+		t.Fatalf("unexpected dangling images %v", dangling)
+	}
+
+	// a second commit of the same image is refused while the first one runs
+	if _, err := lockImageTmp(paths.imageTmpPath("running")); err == nil {
+		t.Fatal("expected error for concurrent commit")
+	}
+}
@@ -1,29 +1,17 @@
 package container
 
-import "fmt"
-
 const (
-	RUNNING       = "running"
-	STOP          = "stopped"
-	Exit          = "exited"
-	InfoLocation  = "/home/root/goproject/Mydocker/log/"
-	InfoLogFormat = InfoLocation + "%s/"
-	JsonLocation  = "/home/root/goproject/Mydocker/json/"
-	JsonFormat    = JsonLocation + "%s/"
-	ConfigName    = "config.json"
-	LogFileName   = "container.log"
-	IDLength      = 10
+	CREATED     = "created"
+	RUNNING     = "running"
+	STOP        = "stopped"
+	Exit        = "exited"
+	ConfigName  = "config.json"
+	PodConfig   = "pod.json"
+	LogFileName = "container.log"
+	IDLength    = 10
 )
 
-// container directory
-const (
-	RootUrl         = "/root/"
-	MergedDirFormat = "/root/%s/merged"
-	WorkDirFormat   = "/root/%s/work"
-	LowerDirFormat  = "/root/%s/lower"
-	UpperDirFormat  = "/root/%s/upper"
-	OverlayFSFormat = "lowerdir=%s,upperdir=%s,workdir=%s"
-)
+const OverlayFSFormat = "lowerdir=%s,upperdir=%s,workdir=%s"
 
 // cgroup configuration
 const (
@@ -36,27 +24,3 @@ const (
 	Perm0644 = 0644 // user has read/write permits, other users have read permits;
 	Perm0622 = 0622 // user has read/write permits, other users have write permits;
 )
-
-func getImage(imageName string) string {
-	return RootUrl + imageName + ".tar"
-}
-
-func getUnTar(imageName string) string {
-	return RootUrl + imageName + "/"
-}
-
-func getLower(containerName string) string {
-	return fmt.Sprintf(LowerDirFormat, containerName)
-}
-
-func getUpper(containerName string) string {
-	return fmt.Sprintf(UpperDirFormat, containerName)
-}
-
-func getWorker(containerName string) string {
-	return fmt.Sprintf(WorkDirFormat, containerName)
-}
-
-func getMerged(containerName string) string {
-	return fmt.Sprintf(MergedDirFormat, containerName)
-}
@@ -1,24 +1,159 @@
 package container
 
 import (
+	"Mydockker/meta"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"syscall"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // 容器信息记录
 type Info struct {
-	Pid         string   `json:"pid"`         //容器进程Id
-	Id          string   `json:"id"`          //容器Id
-	Name        string   `json:"name"`        //容器名
-	Command     string   `json:"command"`     //容器内init进程运行的命令
-	CreateTime  string   `json:"createTime"`  //容器创建时间
-	Status      string   `json:"status"`      //容器状态
-	Volume      string   `json:"volume"`      //容器挂载的数据卷
-	PortMapping []string `json:"portmapping"` //容器内端口映射
+	Pid          string            `json:"pid"`          //容器进程Id
+	StartTime    uint64            `json:"startTime"`    //容器进程启动时间，识别被回收再分配的 pid
+	MonitorPid   int               `json:"monitorPid"`   //等待 init 进程退出的 mydocker run 进程
+	MonitorStart uint64            `json:"monitorStart"` //mydocker run 进程启动时间
+	Id           string            `json:"id"`           //容器Id
+	Name         string            `json:"name"`         //容器名
+	Command      string            `json:"command"`      //容器内init进程运行的命令
+	CreateTime   string            `json:"createTime"`   //容器创建时间
+	StartedAt    string            `json:"startedAt"`    //容器启动时间
+	Status       string            `json:"status"`       //容器状态
+	Volume       string            `json:"volume"`       //容器挂载的数据卷
+	PortMapping  []string          `json:"portmapping"`  //容器内端口映射
+	Capabilities []string          `json:"capabilities"` //容器 init 进程的 capability 集合
+	Privileged   bool              `json:"privileged"`   //是否为特权容器
+	Seccomp      string            `json:"seccomp"`      //seccomp 配置：default、unconfined 或配置文件路径
+	ReadOnly     bool              `json:"readOnly"`     //根目录是否只读
+	Tmpfs        []string          `json:"tmpfs"`        //tmpfs 挂载点
+	Hostname     string            `json:"hostname"`     //容器主机名
+	Domainname   string            `json:"domainname"`   //容器域名
+	Rlimits      []Rlimit          `json:"rlimits"`      //资源限制
+	OomScoreAdj  *int              `json:"oomScoreAdj"`  //oom_score_adj
+	Sysctls      map[string]string `json:"sysctls"`      //内核参数
+	Namespaces   *Namespaces       `json:"namespaces"`   //namespace 共享模式
+	Pod          string            `json:"pod"`          //所属 pod
+	CgroupNS     string            `json:"cgroupns"`     //cgroup namespace 模式
+	TimeOffsets  []TimeOffset      `json:"timeOffsets"`  //time namespace 时钟偏移
+	Image        string            `json:"image"`        //容器镜像
+	Resources    *Resources        `json:"resources"`    //cgroup 资源限制
+	CgroupPath   string            `json:"cgroupPath"`   //容器 cgroup 路径
+	Mounts       []Mount           `json:"mounts"`       //数据卷、tmpfs 挂载
+	Labels       map[string]string `json:"labels"`       //容器标签
+	ExitCode     int               `json:"exitCode"`     //容器退出码
+	OOMKilled    bool              `json:"oomKilled"`    //容器是否被 oom killer 杀死
+	RestartCount int               `json:"restartCount"` //容器重启次数
+	FinishedAt   string            `json:"finishedAt"`   //容器退出时间
+
+	NetworkSettings NetworkSettings `json:"networkSettings"` //容器网络端点
+	LogConfig       LogConfig       `json:"logConfig"`       //容器日志配置
+	Revision        uint64          `json:"revision"`        //记录版本，每次更新加一，用于 compare-and-swap
+}
+
+/**
+ * 容器日志配置：日志驱动和 --log-opt 选项
+ */
+type LogConfig struct {
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+}
+
+/**
+ * 容器资源限制记录，与 subsystems.ResourceConfig 对应
+ */
+type Resources struct {
+	MemoryLimit string `json:"memoryLimit"`
+	CpuCfsQuota int    `json:"cpuCfsQuota"`
+	CpuShare    string `json:"cpuShare"`
+	CpuSet      string `json:"cpuSet"`
+}
+
+/**
+ * 容器挂载记录：bind 数据卷或 tmpfs
+ */
+type Mount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Options     string `json:"options"`
+	Created     bool   `json:"created,omitempty"` //宿主机目录由 mydocker 创建，rm -v 时只删除这类目录
+}
+
+/**
+ * 容器网络端点记录
+ */
+type NetworkSettings struct {
+	Network     string   `json:"network"`     //连接的网络名
+	EndpointID  string   `json:"endpointId"`  //网络端点Id
+	IPAddress   string   `json:"ipAddress"`   //容器IP地址
+	IPPrefixLen int      `json:"ipPrefixLen"` //容器网段前缀长度
+	Gateway     string   `json:"gateway"`     //网关地址
+	MacAddress  string   `json:"macAddress"`  //容器端网卡Mac地址
+	HostVeth    string   `json:"hostVeth"`    //宿主机端 veth 设备名
+	ContainerIf string   `json:"containerIf"` //容器端网卡名
+	Ports       []string `json:"ports"`       //端口映射
+}
+
+/**
+ * logger process of a detached container and write ends of its pipes held by parent
+ */
+type LoggerProcess struct {
+	Process *os.Process
+	Stdout  *os.File
+	Stderr  *os.File
+}
+
+/**
+ * close write ends held by parent and kill logger, used when the container fails to start
+ */
+func (l *LoggerProcess) Stop() {
+	l.Stdout.Close()
+	l.Stderr.Close()
+	if err := l.Process.Kill(); err == nil {
+		_, _ = l.Process.Wait()
+	}
+}
+
+/**
+ * start logger process owning the read ends of container's stdout and stderr pipes
+ * stdout pipe is stdin of logger, stderr pipe is fd 3 of logger
+ * logger tags each line with stream and timestamp and hands it to log driver, exits when all write ends are closed after container exits
+ */
+func startLoggerProcess(exePath, logPath, containerID, containerName string, logConfig *LogConfig) (*LoggerProcess, error) {
+	stdoutRead, stdoutWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer stdoutRead.Close()
+	stderrRead, stderrWrite, err := os.Pipe()
+	if err != nil {
+		stdoutWrite.Close()
+		return nil, err
+	}
+	defer stderrRead.Close()
+	args := []string{"logger", "--log-driver", logConfig.Type, "--id", containerID, "--name", containerName}
+	keys := make([]string, 0, len(logConfig.Config))
+	for key := range logConfig.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--log-opt", key+"="+logConfig.Config[key])
+	}
+	loggerCmd := exec.Command(exePath, append(args, logPath)...)
+	loggerCmd.Stdin = stdoutRead
+	loggerCmd.ExtraFiles = []*os.File{stderrRead}
+	// detach from session, keep running after mydocker exits
+	loggerCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := loggerCmd.Start(); err != nil {
+		stdoutWrite.Close()
+		stderrWrite.Close()
+		return nil, err
+	}
+	return &LoggerProcess{Process: loggerCmd.Process, Stdout: stdoutWrite, Stderr: stderrWrite}, nil
 }
 
 /**
@@ -26,27 +161,48 @@ type Info struct {
  * 1.use /proc/self/exe to create child process which diving by namespace and other environment;
  * 2.use init command param to init child process;
  * 3.redirect input/output/errput;
+ * on failure pipes are closed, logger is stopped and partial workspace is removed
+ * logger of detached container is returned so that a later failure of run can stop it, nil for tty container
  *
  * perf:
  * 1.use pipe to transfer parameters between parentProcess and childProcess. Avoid out-of-buffer and console parameters too long
  */
-func NewParentProcess(tty bool, volume, containerName, imageName string, envSlice []string) (*exec.Cmd, *os.File) {
+func NewParentProcess(paths *Paths, tty bool, volume, containerID, containerName, imageName string, envSlice []string, namespaces *Namespaces, logConfig *LogConfig, mounts []Mount) (*exec.Cmd, *os.File, *LoggerProcess, error) {
 	// create Pipe which transferring parameters between parentProcess and childProcess
 	readPipe, writePipe, err := os.Pipe()
 	if err != nil {
-		log.Errorf("container_process::NewParentProcess new pipe failed")
-		return nil, nil
+		return nil, nil, nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "create init pipe failed", err)
+	}
+	// pipes owned by parent, logger and log directory, released if any following step fails
+	var loggerProcess *LoggerProcess
+	logDir := ""
+	fail := func(err error) (*exec.Cmd, *os.File, *LoggerProcess, error) {
+		readPipe.Close()
+		writePipe.Close()
+		if loggerProcess != nil {
+			loggerProcess.Stop()
+		}
+		if logDir != "" {
+			os.RemoveAll(logDir)
+		}
+		return nil, nil, nil, err
 	}
 	// locate /proc/self/exe executable process
 	exePath, err := os.Readlink("/proc/self/exe")
 	if err != nil {
-		log.Errorf("container_process::NewParentProcess can't find /proc/self/exe link")
-		return nil, nil
+		return fail(meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "can't find /proc/self/exe link", err))
 	}
 	processCmd := exec.Command(exePath, "init")
 	// new process is divided by namespace
+	// cgroup namespace is unshared by init process after joining container's cgroup, see namespace.go
+	// pid/ipc/uts/net namespace shared with host or other container are not created
+	cloneFlags := namespaces.CloneFlags()
+	if IsRootless() {
+		// other namespaces are owned by the new user namespace, uid/gid are mapped by SetupUserNamespace
+		cloneFlags |= syscall.CLONE_NEWUSER
+	}
 	processCmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC,
+		Cloneflags: cloneFlags,
 	}
 	// redirect output/input
 	if tty {
@@ -55,24 +211,40 @@ func NewParentProcess(tty bool, volume, containerName, imageName string, envSlic
 		processCmd.Stderr = os.Stderr
 	} else {
 		// if allow process exec backgroundly, redirect output/input fd
-		dirURL := fmt.Sprintf(InfoLogFormat, containerName)
-		if err := os.MkdirAll(dirURL, Perm0622); err != nil {
-			log.Errorf("container_process::NewParentProcess mkdir log directory failed %s", dirURL)
-			return nil, nil
+		// stdin of detached container is /dev/null, reading from it gets EOF immediately
+		dirURL := paths.LogDir(containerName)
+		if err := os.MkdirAll(dirURL, Perm0755); err != nil {
+			return fail(meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("mkdir log directory %s failed", dirURL), err))
 		}
-		logPath := dirURL + LogFileName
-		file, err := os.Create(logPath)
-		if err != nil {
-			log.Errorf("container_process::NewParentProcess create logFile failed %s", logPath)
-			return nil, nil
+		logDir = dirURL
+		logPath := paths.LogFile(containerName)
+		if loggerProcess, err = startLoggerProcess(exePath, logPath, containerID, containerName, logConfig); err != nil {
+			return fail(meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), "start logger failed", err))
 		}
-		processCmd.Stdout = file
+		// logger exits when write ends are closed
+		processCmd.Stdout = loggerProcess.Stdout
+		processCmd.Stderr = loggerProcess.Stderr
 	}
 	// set readPipe、workingRootfs、environment for parentProcess
 	processCmd.ExtraFiles = []*os.File{readPipe}
-	processCmd.Dir = fmt.Sprintf(MergedDirFormat, containerName)
+	processCmd.Dir = paths.merged(containerName)
 	processCmd.Env = append(os.Environ(), envSlice...)
+	// ipc/uts/net namespaces of other container are joined by nsenter before go runtime starts
+	if paths := namespaces.joinPaths(); len(paths) > 0 {
+		processCmd.Env = append(processCmd.Env, EnvJoinNamespaces+"="+strings.Join(paths, ","))
+	}
+	if IsRootless() {
+		// overlayfs can only be mounted inside the user namespace, leave it to init process
+		processCmd.Env = append(processCmd.Env,
+			EnvRootless+"=1",
+			EnvRootlessOverlay+"="+getOverlayFSDirs(paths.lower(containerName), paths.upper(containerName), paths.worker(containerName)))
+		if volume != "" {
+			processCmd.Env = append(processCmd.Env, EnvRootlessVolume+"="+volume)
+		}
+	}
 	// create overlay2 fileSystem as container root workingspace
-	NewWorkSpace(volume, imageName, containerName)
-	return processCmd, writePipe
+	if err := NewWorkSpace(paths, volume, imageName, containerName, mounts); err != nil {
+		return fail(err)
+	}
+	return processCmd, writePipe, loggerProcess, nil
 }
@@ -0,0 +1,176 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * 容器 /dev、/sys 初始化，在 pivot_root 之前执行
+ * 1./dev 挂载 tmpfs 并创建标准设备节点，user namespace 中无法 mknod，改为 bind 宿主机设备；
+ * 2./dev/pts 挂载 newinstance 的 devpts，/dev/ptmx 指向 pts/ptmx；
+ * 3./dev/shm、/dev/mqueue 分别挂载 tmpfs、mqueue，共享 ipc namespace 时 /dev/shm bind 共享目录；
+ * 4./sys 只读挂载 sysfs，挂载失败时只读 bind 宿主机 /sys；
+ * 5.创建 /dev/fd、stdin、stdout、stderr 软链接；
+ */
+
+// 默认 /dev/shm 大小，与 docker 保持一致
+const DefaultShmSize = "64m"
+
+// 标准设备节点
+var defaultDevices = []struct {
+	name  string
+	major uint32
+	minor uint32
+}{
+	{"null", 1, 3},
+	{"zero", 1, 5},
+	{"full", 1, 7},
+	{"random", 1, 8},
+	{"urandom", 1, 9},
+	{"tty", 5, 0},
+}
+
+// 标准软链接
+var defaultDevSymlinks = [][2]string{
+	{"/proc/self/fd", "fd"},
+	{"/proc/self/fd/0", "stdin"},
+	{"/proc/self/fd/1", "stdout"},
+	{"/proc/self/fd/2", "stderr"},
+	{"pts/ptmx", "ptmx"},
+}
+
+var byteSizePattern = regexp.MustCompile(`^(\d+)([bkmg]?)$`)
+
+/**
+ * 解析 --shm-size，例如 64m、1g、65536，返回字节数
+ */
+func ParseByteSize(size string) (int64, error) {
+	matches := byteSizePattern.FindStringSubmatch(strings.ToLower(size))
+	if matches == nil {
+		return 0, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid size %s", size), nil)
+	}
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid size %s", size), err)
+	}
+	switch matches[2] {
+	case "k":
+		value <<= 10
+	case "m":
+		value <<= 20
+	case "g":
+		value <<= 30
+	}
+	if value <= 0 {
+		return 0, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("size %s must be positive", size), nil)
+	}
+	return value, nil
+}
+
+/**
+ * 挂载容器 /dev 和 /sys，shmPath 不为空时 bind 到 /dev/shm，userns 表示 init 进程位于新的 user namespace 中
+ */
+func mountDevices(root string, shmSize int64, shmPath string, userns bool) error {
+	devDir := filepath.Join(root, "dev")
+	if err := mountFS("tmpfs", devDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755,size=65536k"); err != nil {
+		return err
+	}
+	if err := createDevices(devDir, userns); err != nil {
+		return err
+	}
+	// user namespace 中 gid 5(tty) 不一定存在映射，不指定 gid
+	ptsData := "newinstance,ptmxmode=0666,mode=0620"
+	if !userns {
+		ptsData += ",gid=5"
+	}
+	if err := mountFS("devpts", filepath.Join(devDir, "pts"), "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC, ptsData); err != nil {
+		return err
+	}
+	if shmPath != "" {
+		if err := mountFS(shmPath, filepath.Join(devDir, "shm"), "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return err
+		}
+	} else if err := mountFS("shm", filepath.Join(devDir, "shm"), "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, fmt.Sprintf("mode=1777,size=%d", shmSize)); err != nil {
+		return err
+	}
+	if err := mountFS("mqueue", filepath.Join(devDir, "mqueue"), "mqueue", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return err
+	}
+	for _, link := range defaultDevSymlinks {
+		if err := os.Symlink(link[0], filepath.Join(devDir, link[1])); err != nil && !os.IsExist(err) {
+			return meta.NewError(meta.ErrWrite, fmt.Sprintf("create symlink /dev/%s failed", link[1]), err)
+		}
+	}
+	return mountSysfs(filepath.Join(root, "sys"))
+}
+
+/**
+ * 创建标准设备节点，user namespace 中 mknod 不被允许，使用空文件 bind 宿主机设备
+ */
+func createDevices(devDir string, userns bool) error {
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+	for _, dev := range defaultDevices {
+		target := filepath.Join(devDir, dev.name)
+		if userns {
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, Perm0644)
+			if err != nil {
+				return meta.NewError(meta.ErrWrite, fmt.Sprintf("create device %s failed", target), err)
+			}
+			file.Close()
+			if err := syscall.Mount(filepath.Join("/dev", dev.name), target, "bind", syscall.MS_BIND, ""); err != nil {
+				return meta.NewError(meta.ErrMount, fmt.Sprintf("bind device %s failed", target), err)
+			}
+			continue
+		}
+		devNumber := int(dev.major<<8 | dev.minor)
+		if err := syscall.Mknod(target, syscall.S_IFCHR|0666, devNumber); err != nil {
+			return meta.NewError(meta.ErrWrite, fmt.Sprintf("mknod device %s failed", target), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * 只读挂载 sysfs，没有权限挂载时（例如与宿主机共享 network namespace）只读 bind 宿主机 /sys
+ */
+func mountSysfs(target string) error {
+	if err := os.MkdirAll(target, Perm0755); err != nil {
+		return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir %s failed", target), err)
+	}
+	flags := uintptr(syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	err := syscall.Mount("sysfs", target, "sysfs", flags, "")
+	if err == nil {
+		return nil
+	}
+	if err != syscall.EPERM {
+		return meta.NewError(meta.ErrMount, fmt.Sprintf("mount sysfs %s failed", target), err)
+	}
+	log.Infof("devices::mountSysfs mount sysfs not permitted, bind /sys instead")
+	if err := syscall.Mount("/sys", target, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return meta.NewError(meta.ErrMount, fmt.Sprintf("bind sysfs %s failed", target), err)
+	}
+	return remountReadonly(target)
+}
+
+/**
+ * 创建挂载点并挂载文件系统
+ */
+func mountFS(source, target, fstype string, flags uintptr, data string) error {
+	if err := os.MkdirAll(target, Perm0755); err != nil {
+		return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir %s failed", target), err)
+	}
+	if err := syscall.Mount(source, target, fstype, flags, data); err != nil {
+		return meta.NewError(meta.ErrMount, fmt.Sprintf("mount %s on %s failed", fstype, target), err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package container
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"65536": 65536,
+		"64m":   64 << 20,
+		"1G":    1 << 30,
+		"512k":  512 << 10,
+	}
+	for input, expected := range cases {
+		size, err := ParseByteSize(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expected {
+			t.Fatalf("ParseByteSize(%s) = %d, expected %d", input, size, expected)
+		}
+	}
+	for _, input := range []string{"", "0", "-1m", "64mb"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
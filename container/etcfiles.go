@@ -0,0 +1,247 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * 容器 /etc/hostname、/etc/hosts、/etc/resolv.conf 管理
+ * 1.文件生成在容器状态目录下，init 进程在 pivot_root 之前 bind 到 rootfs；
+ * 2.连接、断开网络时更新 hosts、resolv.conf；
+ * 文件以 bind 方式挂载，更新时必须原地改写，不能替换 inode
+ */
+
+const (
+	HostnameFileName   = "hostname"
+	HostsFileName      = "hosts"
+	ResolvConfFileName = "resolv.conf"
+)
+
+const (
+	hostResolvConf     = "/etc/resolv.conf"
+	resolvedResolvConf = "/run/systemd/resolve/resolv.conf"
+)
+
+// 宿主机 resolv.conf 中只有本地地址时使用的 DNS
+var defaultNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// hosts 文件默认内容
+const defaultHosts = `127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+ff00::0	ip6-mcastprefix
+ff02::1	ip6-allnodes
+ff02::2	ip6-allrouters
+`
+
+func (p *Paths) HostnamePath(containerName string) string {
+	return filepath.Join(p.StateDir(containerName), HostnameFileName)
+}
+
+func (p *Paths) HostsPath(containerName string) string {
+	return filepath.Join(p.StateDir(containerName), HostsFileName)
+}
+
+func (p *Paths) ResolvConfPath(containerName string) string {
+	return filepath.Join(p.StateDir(containerName), ResolvConfFileName)
+}
+
+/**
+ * 生成容器的 hostname、hosts、resolv.conf
+ * resolv.conf 来自宿主机，过滤容器内无法访问的本地 nameserver
+ */
+func CreateEtcFiles(paths *Paths, containerName, hostname, domainname string) error {
+	stateDir := paths.StateDir(containerName)
+	if err := os.MkdirAll(stateDir, Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("mkdir state dir %s failed", stateDir), err)
+	}
+	// 共享 uts namespace 时不生成 hostname
+	if hostname != "" {
+		if err := writeEtcFile(paths.HostnamePath(containerName), hostname+"\n"); err != nil {
+			return err
+		}
+	}
+	if err := writeEtcFile(paths.HostsPath(containerName), defaultHosts); err != nil {
+		return err
+	}
+	return writeEtcFile(paths.ResolvConfPath(containerName), filterResolvConf(readHostResolvConf()))
+}
+
+/**
+ * 连接网络后添加容器 IP 和主机名的 hosts 记录
+ */
+func AddHostsEntry(paths *Paths, containerName, ip, hostname, domainname string) error {
+	hostsPath := paths.HostsPath(containerName)
+	content, err := ioutil.ReadFile(hostsPath)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read hosts %s failed", hostsPath), err)
+	}
+	return writeEtcFile(hostsPath, addHostsEntry(string(content), ip, hostname, domainname))
+}
+
+/**
+ * 断开网络后移除容器 IP 的 hosts 记录
+ */
+func RemoveHostsEntry(paths *Paths, containerName, ip string) error {
+	hostsPath := paths.HostsPath(containerName)
+	content, err := ioutil.ReadFile(hostsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read hosts %s failed", hostsPath), err)
+	}
+	return writeEtcFile(hostsPath, removeHostsEntry(string(content), ip))
+}
+
+/**
+ * 使用指定 nameserver 改写 resolv.conf，保留 search、options 配置
+ */
+func UpdateResolvConf(paths *Paths, containerName string, nameservers []string) error {
+	resolvPath := paths.ResolvConfPath(containerName)
+	content, err := ioutil.ReadFile(resolvPath)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read resolv.conf %s failed", resolvPath), err)
+	}
+	var lines []string
+	for _, ns := range nameservers {
+		lines = append(lines, "nameserver "+ns)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "nameserver" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return writeEtcFile(resolvPath, strings.Join(lines, "\n")+"\n")
+}
+
+func addHostsEntry(content, ip, hostname, domainname string) string {
+	names := hostname
+	if domainname != "" {
+		names = fmt.Sprintf("%s.%s %s", hostname, domainname, hostname)
+	}
+	return removeHostsEntry(content, ip) + fmt.Sprintf("%s\t%s\n", ip, names)
+}
+
+func removeHostsEntry(content, ip string) string {
+	var builder strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		fields := strings.Fields(line)
+		if line == "" || (len(fields) > 0 && fields[0] == ip) {
+			continue
+		}
+		builder.WriteString(line)
+	}
+	return builder.String()
+}
+
+/**
+ * 读取宿主机 resolv.conf，systemd-resolved 的 stub 地址在容器内不可用，优先读取上游配置
+ */
+func readHostResolvConf() string {
+	content, err := ioutil.ReadFile(hostResolvConf)
+	if err != nil {
+		log.Warnf("etcfiles::readHostResolvConf read %s failed %v", hostResolvConf, err)
+		return ""
+	}
+	if strings.Contains(string(content), "127.0.0.53") {
+		if upstream, err := ioutil.ReadFile(resolvedResolvConf); err == nil {
+			return string(upstream)
+		}
+	}
+	return string(content)
+}
+
+/**
+ * 移除本地 nameserver，全部被移除时使用默认 DNS
+ */
+func filterResolvConf(content string) string {
+	var lines []string
+	hasNameserver := false
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "nameserver" {
+			if len(fields) < 2 || isLocalNameserver(fields[1]) {
+				continue
+			}
+			hasNameserver = true
+		}
+		lines = append(lines, line)
+	}
+	if !hasNameserver {
+		for _, ns := range defaultNameservers {
+			lines = append(lines, "nameserver "+ns)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func isLocalNameserver(ns string) bool {
+	return strings.HasPrefix(ns, "127.") || ns == "::1"
+}
+
+/**
+ * 原地改写文件，保持 bind 挂载的 inode 不变
+ */
+func writeEtcFile(filePath, content string) error {
+	if err := ioutil.WriteFile(filePath, []byte(content), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("write %s failed", filePath), err)
+	}
+	return nil
+}
+
+/**
+ * init 进程设置 hostname、domainname 并 bind /etc 文件到 rootfs
+ */
+func setupEtcFiles(root string, initConf *InitConfig) error {
+	if initConf.Hostname != "" {
+		if err := syscall.Sethostname([]byte(initConf.Hostname)); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("set hostname %s failed", initConf.Hostname), err)
+		}
+	}
+	if initConf.Domainname != "" {
+		if err := syscall.Setdomainname([]byte(initConf.Domainname)); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("set domainname %s failed", initConf.Domainname), err)
+		}
+	}
+	etcFiles := map[string]string{
+		HostnameFileName:   initConf.HostnamePath,
+		HostsFileName:      initConf.HostsPath,
+		ResolvConfFileName: initConf.ResolvConfPath,
+	}
+	for name, source := range etcFiles {
+		if source == "" {
+			continue
+		}
+		target := filepath.Join(root, "etc", name)
+		if err := os.MkdirAll(filepath.Dir(target), Perm0755); err != nil {
+			return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir %s failed", filepath.Dir(target)), err)
+		}
+		// 镜像中不存在时创建挂载点，存在软链接时替换为普通文件
+		if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			os.Remove(target)
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, Perm0644)
+		if err != nil {
+			return meta.NewError(meta.ErrWrite, fmt.Sprintf("create %s failed", target), err)
+		}
+		file.Close()
+		if err := syscall.Mount(source, target, "bind", syscall.MS_BIND, ""); err != nil {
+			return meta.NewError(meta.ErrMount, fmt.Sprintf("bind %s to %s failed", source, target), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package container
+
+import "testing"
+
+func TestFilterResolvConf(t *testing.T) {
+	content := "# generated\nnameserver 127.0.0.53\nnameserver 10.1.1.1\nsearch example.com\n"
+	expected := "nameserver 10.1.1.1\nsearch example.com\n"
+	if got := filterResolvConf(content); got != expected {
+		t.Fatalf("unexpected resolv.conf %q", got)
+	}
+	expected = "nameserver 8.8.8.8\nnameserver 8.8.4.4\n"
+	if got := filterResolvConf("nameserver ::1\n"); got != expected {
+		t.Fatalf("unexpected resolv.conf %q", got)
+	}
+}
+
+func TestHostsEntry(t *testing.T) {
+	content := addHostsEntry(defaultHosts, "10.0.2.100", "web", "example.com")
+	content = addHostsEntry(content, "10.0.2.100", "web", "")
+	if content != defaultHosts+"10.0.2.100\tweb\n" {
+		t.Fatalf("unexpected hosts %q", content)
+	}
+	if content = removeHostsEntry(content, "10.0.2.100"); content != defaultHosts {
+		t.Fatalf("unexpected hosts %q", content)
+	}
+}
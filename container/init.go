@@ -2,32 +2,87 @@ package container
 
 import (
 	"Mydockker/meta"
+	"Mydockker/seccomp"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
+/**
+ * configuration transferred from parentProcess to init process by readPipe
+ */
+type InitConfig struct {
+	Args           []string          `json:"args"`           //用户命令
+	Capabilities   []string          `json:"capabilities"`   //容器 capability 集合
+	Privileged     bool              `json:"privileged"`     //特权容器保留全部 capability
+	SeccompFilter  []unix.SockFilter `json:"seccompFilter"`  //编译后的 seccomp BPF 程序，为空表示 unconfined
+	ReadOnly       bool              `json:"readOnly"`       //只读挂载根目录
+	Tmpfs          []string          `json:"tmpfs"`          //tmpfs 挂载点，格式为 path[:options]
+	MaskedPaths    []string          `json:"maskedPaths"`    //屏蔽的内核接口
+	ReadonlyPaths  []string          `json:"readonlyPaths"`  //只读的内核接口
+	ShmSize        int64             `json:"shmSize"`        ///dev/shm 大小，单位字节
+	Hostname       string            `json:"hostname"`       //容器主机名
+	Domainname     string            `json:"domainname"`     //容器域名
+	HostnamePath   string            `json:"hostnamePath"`   //宿主机上生成的 /etc/hostname
+	HostsPath      string            `json:"hostsPath"`      //宿主机上生成的 /etc/hosts
+	ResolvConfPath string            `json:"resolvConfPath"` //宿主机上生成的 /etc/resolv.conf
+	Rlimits        []Rlimit          `json:"rlimits"`        //资源限制
+	OomScoreAdj    *int              `json:"oomScoreAdj"`    //oom_score_adj，为空表示继承
+	Sysctls        map[string]string `json:"sysctls"`        //namespace 隔离的内核参数
+	CgroupNS       string            `json:"cgroupns"`       //cgroup namespace 模式：host、private
+	TimeOffsets    []TimeOffset      `json:"timeOffsets"`    //time namespace 时钟偏移，为空表示不创建
+	ShmPath        string            `json:"shmPath"`        //共享 ipc namespace 时 bind 到 /dev/shm 的目录
+}
+
 /**
  * after create containerProcess, its the first process to init process's resource
- * 1.mount current process proc config;
- * 2.read commands from readPipe;
- * 3.execve run command to replace init process as first process;
+ * 1.re-exec as root of user namespace in rootless mode;
+ * 2.read initConfig from readPipe;
+ * 3.unshare cgroup namespace after parent process applied cgroup, mount rootfs in rootless mode;
+ * 4.mount current process proc、dev、sys config;
+ * 5.create time namespace, set rlimits and oom_score_adj, then drop capabilities;
+ * 6.install seccomp filter;
+ * 7.execve run command to replace init process as first process;
  */
 func ContainerResourceInit() error {
+	rootless := os.Getenv(EnvRootless) != ""
+	if rootless && os.Getenv(EnvUserNSReady) == "" {
+		return reexecInUserNamespace()
+	}
 	// read parameters from readPipe
-	cmdArrays := readUserCommands()
-	if len(cmdArrays) == 0 {
+	initConf := readInitConfig()
+	if initConf == nil || len(initConf.Args) == 0 {
 		return errors.New("init::ContainerResourceInit userCommands is nil")
 	}
+	cmdArrays := initConf.Args
+	// namespaces created by unshare only take effect on current thread, keep it until execve
+	runtime.LockOSThread()
+	if initConf.CgroupNS == CgroupNSPrivate {
+		if err := unshareCgroupNamespace(); err != nil {
+			log.Errorf("init::ContainerResourceInit unshare cgroup namespace failed, err=%v", err)
+			return err
+		}
+	}
+	if rootless {
+		if err := mountRootlessWorkSpace(); err != nil {
+			log.Errorf("init::ContainerResourceInit mount rootless workspace failed, err=%v", err)
+			return err
+		}
+	}
 	// proc mount
-	mountProc()
+	if err := mountProc(initConf, rootless); err != nil {
+		log.Errorf("init::ContainerResourceInit mount rootfs failed, err=%v", err)
+		return err
+	}
 	// execute user commands
 	path, err := exec.LookPath(cmdArrays[0])
 	if err != nil {
@@ -35,7 +90,32 @@ func ContainerResourceInit() error {
 		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "exec lookPath not found", err)
 	}
 	log.Infof("init::ContainerResourceInit execuatble path=%v", path)
-	if err = syscall.Exec(path, cmdArrays[0:], os.Environ()); err != nil {
+	if err = setupTimeNamespace(initConf.TimeOffsets); err != nil {
+		log.Errorf("init::ContainerResourceInit setup time namespace failed, err=%v", err)
+		return err
+	}
+	// rlimits and oom_score_adj may require CAP_SYS_RESOURCE
+	if err = applyRlimits(initConf.Rlimits); err != nil {
+		log.Errorf("init::ContainerResourceInit apply rlimits failed, err=%v", err)
+		return err
+	}
+	if err = applyOomScoreAdj(initConf.OomScoreAdj); err != nil {
+		log.Errorf("init::ContainerResourceInit apply oom_score_adj failed, err=%v", err)
+		return err
+	}
+	// drop capabilities before installing seccomp filter
+	if !initConf.Privileged {
+		if err = applyCapabilities(initConf.Capabilities); err != nil {
+			log.Errorf("init::ContainerResourceInit apply capabilities failed, err=%v", err)
+			return err
+		}
+	}
+	// install seccomp filter as the last step before exec
+	if err = seccomp.InitSeccomp(initConf.SeccompFilter); err != nil {
+		log.Errorf("init::ContainerResourceInit install seccomp failed, err=%v", err)
+		return err
+	}
+	if err = syscall.Exec(path, cmdArrays[0:], containerEnviron()); err != nil {
 		log.Errorf("init::ContainerResourceInit exec failed, err=%v", err)
 		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "exec user commands", err)
 	}
@@ -50,41 +130,80 @@ func ContainerResourceInit() error {
  *	 2.syscall.MS_NOSUID：本系统运行程序时不允许 set-user-id、set-group-id；
  *   3.syscall.MS_NODEV：mount默认都会携带；
  * systemd 加入 linux后，mount namespace 更新为 shared by default，所以必须显式声明 mount namespace 独立于宿主机
+ * proc 在 pivot_root 之前挂载，user namespace 中要求挂载时宿主机 proc 仍然可见
+ * /dev、/sys、tmpfs、masked paths、readonly paths 同样在 pivot_root 之前处理，--read-only 在 pivot_root 之后重新挂载根目录
  */
-func mountProc() {
+func mountProc(initConf *InitConfig, userns bool) error {
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Errorf("Get current location failed %v", err)
-		return
+		return meta.NewError(meta.ErrRead, "get current location failed", err)
 	}
 	log.Infof("Current location is %s", pwd)
 	// change mount transferMode for private
 	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
 		log.Errorf("mount default namespace failed, err = %v", err)
-		return
+		return meta.NewError(meta.ErrMount, "mount default namespace private failed", err)
 	}
-	// remount rootfs
-	if err = privotRoot(pwd); err != nil {
-		log.Errorf("reMount failed %v", err)
+	// bind rootfs to itself, new_root of pivot_root must be a mount point
+	if err := syscall.Mount(pwd, pwd, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		log.Errorf("reMount rootfs failed, err = %v", err)
+		return meta.NewError(meta.ErrMount, "bind rootfs failed", err)
 	}
 	// mount proc
 	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	if err := syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), ""); err != nil {
+	procDir := filepath.Join(pwd, "proc")
+	if err := os.MkdirAll(procDir, Perm0755); err != nil {
+		log.Errorf("mkdir proc failed, err = %v", err)
+		return meta.NewError(meta.ErrWrite, "mkdir proc failed", err)
+	}
+	if err := syscall.Mount("proc", procDir, "proc", uintptr(defaultMountFlags), ""); err != nil {
 		log.Errorf("mount proc failed, err = %v", err)
-		return
+		return meta.NewError(meta.ErrMount, "mount proc failed", err)
+	}
+	// set namespaced sysctls before /proc/sys is remounted read-only
+	if err := applySysctls(procDir, initConf.Sysctls); err != nil {
+		return err
+	}
+	// mount /dev and /sys, masked paths under /sys require sysfs mounted first
+	if err := mountDevices(pwd, initConf.ShmSize, initConf.ShmPath, userns); err != nil {
+		return err
+	}
+	// set hostname and bind /etc/hostname、/etc/hosts、/etc/resolv.conf
+	if err := setupEtcFiles(pwd, initConf); err != nil {
+		return err
+	}
+	// rootfs hardening
+	if err := mountTmpfs(pwd, initConf.Tmpfs); err != nil {
+		return err
+	}
+	if err := maskPaths(pwd, initConf.MaskedPaths); err != nil {
+		return err
+	}
+	if err := readonlyPaths(pwd, initConf.ReadonlyPaths); err != nil {
+		return err
+	}
+	// remount rootfs
+	if err = privotRoot(pwd); err != nil {
+		log.Errorf("reMount failed %v", err)
+		return err
+	}
+	if initConf.ReadOnly {
+		return remountReadonly("/")
 	}
+	return nil
 }
 
 const readPipe = 3
 
 /**
- * read userCommands from readPipe(3)
+ * read initConfig from readPipe(3)
  * 0——stdin
  * 1——stdout
  * 2——stderr
  * 3——readPipe
  */
-func readUserCommands() []string {
+func readInitConfig() *InitConfig {
 	pipe := os.NewFile(readPipe, "pipe")
 	defer pipe.Close()
 	msg, err := ioutil.ReadAll(pipe)
@@ -92,16 +211,18 @@ func readUserCommands() []string {
 		log.Errorf("init readPipe failed, err=%v", err)
 		return nil
 	}
-	return strings.Split(string(msg), " ")
+	initConf := new(InitConfig)
+	if err := json.Unmarshal(msg, initConf); err != nil {
+		log.Errorf("init unmarshal initConfig failed, err=%v", err)
+		return nil
+	}
+	return initConf
 }
 
 /**
  * change rootfs of container
  */
 func privotRoot(root string) error {
-	if err := syscall.Mount(root, root, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
-		return meta.NewError(meta.ErrMount, "reMount rootfs failed", err)
-	}
 	// create directory "rootfs/.pivot_root" to save old_rootfs
 	pivotDir := filepath.Join(root, ".pivot_root")
 	if err := os.Mkdir(pivotDir, Perm0777); err != nil {
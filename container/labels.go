@@ -0,0 +1,126 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+/**
+ * 容器、镜像、网络的标签
+ * 1.--label-file 每行一个 k=v，忽略空行和 # 注释；
+ * 2.--label 覆盖 --label-file 中的同名标签；
+ * 3.过滤条件 label=k 匹配存在该标签，label=k=v 匹配标签值；
+ * Usage: ./Mydocker run --label team=infra --label-file ./labels -d busybox top
+ */
+
+/**
+ * 解析 --label、--label-file
+ */
+func ParseLabels(labels, labelFiles []string) (map[string]string, error) {
+	var lines []string
+	for _, labelFile := range labelFiles {
+		fileLines, err := readLabelFile(labelFile)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, fileLines...)
+	}
+	lines = append(lines, labels...)
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(lines))
+	for _, line := range lines {
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid label %s, key can't be empty", line), nil)
+		}
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func readLabelFile(labelFile string) ([]string, error) {
+	file, err := os.Open(labelFile)
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("open label file %s failed", labelFile), err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read label file %s failed", labelFile), err)
+	}
+	return lines, nil
+}
+
+/**
+ * 标签过滤：k 匹配存在该标签，k=v 匹配标签值
+ */
+func MatchLabel(labels map[string]string, filter string) bool {
+	kv := strings.SplitN(filter, "=", 2)
+	value, ok := labels[kv[0]]
+	return ok && (len(kv) == 1 || value == kv[1])
+}
+
+/**
+ * 镜像元数据，与镜像 tar 包同目录保存为 ${imageName}.json
+ */
+type ImageMeta struct {
+	Name      string            `json:"name"`
+	Container string            `json:"container"` //提交镜像的容器
+	Created   string            `json:"created"`
+	Labels    map[string]string `json:"labels"`
+}
+
+/**
+ * 读取镜像元数据，外部导入的镜像没有元数据时返回 nil
+ */
+func LoadImageMeta(paths *Paths, imageName string) (*ImageMeta, error) {
+	content, err := ioutil.ReadFile(paths.imageMetaPath(imageName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read image meta of %s failed", imageName), err)
+	}
+	imageMeta := new(ImageMeta)
+	if err := json.Unmarshal(content, imageMeta); err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), fmt.Sprintf("unmarshal image meta of %s failed", imageName), err)
+	}
+	return imageMeta, nil
+}
+
+func writeImageMeta(paths *Paths, imageName, containerName string, labels map[string]string) error {
+	content, err := json.Marshal(&ImageMeta{
+		Name:      imageName,
+		Container: containerName,
+		Created:   time.Now().Format("2006-01-02 15:04:05"),
+		Labels:    labels,
+	})
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), "marshal image meta failed", err)
+	}
+	if err := ioutil.WriteFile(paths.imageMetaPath(imageName), content, Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("write image meta of %s failed", imageName), err)
+	}
+	return nil
+}
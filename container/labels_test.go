@@ -0,0 +1,29 @@
+package container
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	labelFile := filepath.Join(t.TempDir(), "labels")
+	if err := ioutil.WriteFile(labelFile, []byte("# team labels\nteam=infra\n\nservice=web\n"), Perm0644); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := ParseLabels([]string{"service=api", "canary"}, []string{labelFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"team": "infra", "service": "api", "canary": ""}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if _, err := ParseLabels([]string{"=v"}, nil); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+	if !MatchLabel(labels, "team") || !MatchLabel(labels, "team=infra") || MatchLabel(labels, "team=db") || MatchLabel(labels, "owner") {
+		t.Fatal("unexpected label match result")
+	}
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 容器进程存活检查
+ * pid 会被内核回收再分配，宿主机重启后记录中的 pid 也可能属于其他进程
+ * 因此除了进程存在，还要求进程启动时间（/proc/<pid>/stat 第 22 项，开机以来的 clock tick）与启动容器时记录的一致
+ */
+
+/**
+ * 读取进程启动时间
+ */
+func ProcessStartTime(pid int) (uint64, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read stat of process %d failed", pid), err)
+	}
+	_, startTime, err := parseProcStat(string(content))
+	return startTime, err
+}
+
+/**
+ * 进程存活且启动时间与记录一致，startTime 为 0 时（没有记录启动时间）只检查进程存在
+ * 已退出未回收的僵尸进程视为不存活
+ */
+func IsProcessAlive(pid int, startTime uint64) bool {
+	if pid <= 0 {
+		return false
+	}
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	state, actual, err := parseProcStat(string(content))
+	if err != nil || state == "Z" || state == "X" {
+		return false
+	}
+	return startTime == 0 || startTime == actual
+}
+
+/**
+ * 容器 init 进程是否仍在运行
+ */
+func (info *Info) IsAlive() bool {
+	pid, err := strconv.Atoi(strings.TrimSpace(info.Pid))
+	if err != nil {
+		return false
+	}
+	return IsProcessAlive(pid, info.StartTime)
+}
+
+/**
+ * 等待 init 进程退出的 mydocker run 进程是否仍在运行，运行时由它记录退出码
+ */
+func (info *Info) IsMonitored() bool {
+	return IsProcessAlive(info.MonitorPid, info.MonitorStart)
+}
+
+/**
+ * 解析 /proc/<pid>/stat，返回进程状态和启动时间
+ * 第二项 comm 被括号包围且可能包含空格和括号，从最后一个右括号之后开始按空格切分
+ */
+func parseProcStat(stat string) (string, uint64, error) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return "", 0, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), fmt.Sprintf("invalid process stat %q", stat), nil)
+	}
+	// 右括号之后从第 3 项 state 开始，starttime 是第 22 项
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return "", 0, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), fmt.Sprintf("invalid process stat %q", stat), nil)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return "", 0, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), fmt.Sprintf("invalid start time %q", fields[19]), err)
+	}
+	return fields[0], startTime, nil
+}
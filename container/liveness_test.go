@@ -0,0 +1,39 @@
+package container
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat := "4242 (my (weird) cmd) S 1 4242 4242 0 -1 4194560 120 0 0 0 1 2 0 0 20 0 1 0 987654 5672960 200 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0"
+	state, startTime, err := parseProcStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "S" || startTime != 987654 {
+		t.Fatalf("unexpected state %s start time %d", state, startTime)
+	}
+	if _, _, err := parseProcStat("4242 (cmd) S 1"); err == nil {
+		t.Fatal("expected error for truncated stat")
+	}
+}
+
+func TestIsProcessAlive(t *testing.T) {
+	pid := os.Getpid()
+	startTime, err := ProcessStartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsProcessAlive(pid, startTime) || !IsProcessAlive(pid, 0) {
+		t.Fatal("current process should be alive")
+	}
+	// pid reused by another process
+	if IsProcessAlive(pid, startTime+1) {
+		t.Fatal("process with different start time should not be trusted")
+	}
+	info := &Info{Pid: " "}
+	if info.IsAlive() {
+		t.Fatal("container without pid should not be alive")
+	}
+}
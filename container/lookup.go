@@ -0,0 +1,58 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/**
+ * 按完整 Id、容器名、唯一 Id 前缀查找容器，优先级依次降低
+ * 多个容器 Id 以同一前缀开头时报错，需要更长的前缀
+ */
+func MatchContainer(infos []*Info, ref string) (*Info, error) {
+	if ref == "" {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), "container name or id can't be empty", nil)
+	}
+	for _, info := range infos {
+		if info.Id == ref {
+			return info, nil
+		}
+	}
+	for _, info := range infos {
+		if info.Name == ref {
+			return info, nil
+		}
+	}
+	var matches []*Info
+	for _, info := range infos {
+		if strings.HasPrefix(info.Id, ref) {
+			matches = append(matches, info)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), fmt.Sprintf("no such container: %s", ref), nil)
+	case 1:
+		return matches[0], nil
+	}
+	ids := make([]string, 0, len(matches))
+	for _, info := range matches {
+		ids = append(ids, info.Id)
+	}
+	return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("container id prefix %s is ambiguous, matches %s", ref, strings.Join(ids, ", ")), nil)
+}
+
+// 容器名用于状态目录、overlay 目录路径，字符集与 docker 一致
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+/**
+ * 校验容器名合法性
+ */
+func ValidateContainerName(name string) error {
+	if !containerNamePattern.MatchString(name) {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid container name %s, only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", name), nil)
+	}
+	return nil
+}
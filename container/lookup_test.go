@@ -0,0 +1,38 @@
+package container
+
+import "testing"
+
+func TestMatchContainer(t *testing.T) {
+	infos := []*Info{
+		{Id: "abc123", Name: "web"},
+		{Id: "abd456", Name: "db"},
+		{Id: "ffff00", Name: "abc123x"},
+	}
+	for ref, expected := range map[string]string{"abc123": "web", "db": "db", "abc": "web", "ff": "abc123x", "abc123x": "abc123x"} {
+		info, err := MatchContainer(infos, ref)
+		if err != nil {
+			t.Fatalf("match %s failed: %v", ref, err)
+		}
+		if info.Name != expected {
+			t.Fatalf("match %s: expected %s, got %s", ref, expected, info.Name)
+		}
+	}
+	for _, invalid := range []string{"ab", "zzz", ""} {
+		if _, err := MatchContainer(infos, invalid); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestValidateContainerName(t *testing.T) {
+	for _, valid := range []string{"web", "web-1.prod_a", "1abc"} {
+		if err := ValidateContainerName(valid); err != nil {
+			t.Fatalf("unexpected error for %s: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "-web", "../etc", "a/b", "a b"} {
+		if err := ValidateContainerName(invalid); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+}
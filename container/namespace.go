@@ -0,0 +1,316 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * cgroup namespace 与 time namespace
+ * 1.cgroup namespace 的根为创建时所在的 cgroup，容器进程 clone 时尚未加入容器 cgroup，
+ *   所以由 init 进程在父进程完成 cgroup 设置之后 unshare；
+ * 2.time namespace 只能通过 unshare 创建并作用于子进程，init 进程 unshare 后写入 timens_offsets，
+ *   execve 时进入新的 time namespace；
+ * namespace 按线程生效，init 进程需要锁定线程直到 execve
+ * Usage: ./Mydocker run --cgroupns host --time-offset monotonic=86400s,boottime=-1h xxx
+ */
+
+const (
+	CgroupNSHost    = "host"
+	CgroupNSPrivate = "private"
+)
+
+const timensOffsetsFile = "/proc/self/timens_offsets"
+
+// time namespace 支持的时钟
+var timensClocks = map[string]bool{
+	"monotonic": true,
+	"boottime":  true,
+}
+
+/**
+ * time namespace 时钟偏移
+ */
+type TimeOffset struct {
+	Clock       string `json:"clock"`       //monotonic 或 boottime
+	Seconds     int64  `json:"seconds"`     //秒
+	Nanoseconds int64  `json:"nanoseconds"` //纳秒，范围 [0, 1e9)
+}
+
+/**
+ * 校验 --cgroupns
+ */
+func ValidateCgroupNS(mode string) error {
+	if mode != CgroupNSHost && mode != CgroupNSPrivate {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid cgroupns mode %s, must be host or private", mode), nil)
+	}
+	return nil
+}
+
+/**
+ * 解析 --time-offset，格式为 clock=offset[,clock=offset]，offset 为秒数或 time.Duration，例如 86400、-1h30m
+ */
+func ParseTimeOffsets(opt string) ([]TimeOffset, error) {
+	if opt == "" {
+		return nil, nil
+	}
+	var offsets []TimeOffset
+	for _, item := range strings.Split(opt, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || !timensClocks[kv[0]] {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid time offset %s, format is monotonic|boottime=offset", item), nil)
+		}
+		offset, err := parseTimeOffset(kv[1])
+		if err != nil {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid time offset %s", item), err)
+		}
+		// 纳秒部分必须非负，负偏移向下取整到秒
+		seconds := int64(offset / time.Second)
+		nanoseconds := int64(offset % time.Second)
+		if nanoseconds < 0 {
+			seconds--
+			nanoseconds += int64(time.Second)
+		}
+		offsets = append(offsets, TimeOffset{Clock: kv[0], Seconds: seconds, Nanoseconds: nanoseconds})
+	}
+	return offsets, nil
+}
+
+func parseTimeOffset(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+/**
+ * 以当前 cgroup 为根创建 cgroup namespace
+ */
+func unshareCgroupNamespace() error {
+	if err := unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "unshare cgroup namespace failed", err)
+	}
+	return nil
+}
+
+/**
+ * 创建 time namespace 并写入时钟偏移，偏移只能在有进程进入 namespace 之前写入
+ */
+func setupTimeNamespace(offsets []TimeOffset) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := unix.Unshare(unix.CLONE_NEWTIME); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "unshare time namespace failed", err)
+	}
+	var lines []string
+	for _, o := range offsets {
+		lines = append(lines, fmt.Sprintf("%s %d %d", o.Clock, o.Seconds, o.Nanoseconds))
+	}
+	if err := ioutil.WriteFile(timensOffsetsFile, []byte(strings.Join(lines, "\n")), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "write timens_offsets failed", err)
+	}
+	return nil
+}
+
+/**
+ * namespace 共享模式：--pid、--ipc、--uts、--net
+ * 1.private（默认）：clone 时创建新的 namespace；
+ * 2.host：不创建 namespace，与宿主机共享；
+ * 3.container:<name>：加入其它容器的 namespace，pid 在父进程 clone 前 setns，其余由 nsenter 在子进程 Go runtime 启动前 setns；
+ * Usage: ./Mydocker run --pid container:web --net host xxx
+ */
+
+const (
+	NamespaceModePrivate = "private"
+	NamespaceModeHost    = "host"
+	namespaceModePrefix  = "container:"
+)
+
+// 子进程中需要 setns 的 namespace 文件，格式为 /proc/<pid>/ns/<type>，多个以逗号分隔，由 nsenter 读取
+const EnvJoinNamespaces = "mydocker_setns"
+
+/**
+ * 容器 namespace 配置
+ */
+type Namespaces struct {
+	Pid string `json:"pid"` //pid namespace 模式
+	Ipc string `json:"ipc"` //ipc namespace 模式
+	Uts string `json:"uts"` //uts namespace 模式
+	Net string `json:"net"` //net namespace 模式
+	// 加入其它容器时目标容器的 pid，由 Resolve 填充
+	joinPids map[string]string
+}
+
+/**
+ * namespace 类型、模式与 clone flag
+ */
+type namespaceKind struct {
+	name string
+	mode string
+	flag uintptr
+}
+
+/**
+ * ipc、uts、net 按 nsenter 的 setns 顺序排列
+ */
+func (n *Namespaces) kinds() []namespaceKind {
+	return []namespaceKind{
+		{"ipc", n.Ipc, unix.CLONE_NEWIPC},
+		{"uts", n.Uts, unix.CLONE_NEWUTS},
+		{"net", n.Net, unix.CLONE_NEWNET},
+		{"pid", n.Pid, unix.CLONE_NEWPID},
+	}
+}
+
+/**
+ * 模式为 container:<name> 时返回容器名
+ */
+func NamespaceContainer(mode string) (string, bool) {
+	if !strings.HasPrefix(mode, namespaceModePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(mode, namespaceModePrefix), true
+}
+
+/**
+ * 是否创建新的 namespace
+ */
+func IsPrivateNamespace(mode string) bool {
+	return mode == "" || mode == NamespaceModePrivate
+}
+
+/**
+ * 校验 namespace 模式，rootless 模式下无法在宿主机 namespace 中挂载 proc、mqueue，
+ * 也无法加入其它 user namespace 拥有的 namespace，只支持 --net host
+ */
+func (n *Namespaces) Validate(rootless bool) error {
+	for _, kind := range n.kinds() {
+		name, isContainer := NamespaceContainer(kind.mode)
+		if !IsPrivateNamespace(kind.mode) && kind.mode != NamespaceModeHost && (!isContainer || name == "") {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid %s namespace mode %s, must be private, host or container:<name>", kind.name, kind.mode), nil)
+		}
+		if rootless && !IsPrivateNamespace(kind.mode) && !(kind.name == "net" && kind.mode == NamespaceModeHost) {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("%s namespace mode %s is not supported in rootless mode", kind.name, kind.mode), nil)
+		}
+	}
+	return nil
+}
+
+/**
+ * 依赖的容器，依赖的容器运行时不能删除
+ */
+func (n *Namespaces) Dependencies() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, kind := range n.kinds() {
+		if name, ok := NamespaceContainer(kind.mode); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+/**
+ * 解析加入的容器，lookup 按容器名、Id 或 Id 前缀返回运行中容器的容器名和 pid
+ * 模式统一改写为 container:<name>，便于删除容器时检查依赖
+ */
+func (n *Namespaces) Resolve(lookup func(ref string) (string, string, error)) error {
+	n.joinPids = map[string]string{}
+	for _, kind := range n.kinds() {
+		ref, ok := NamespaceContainer(kind.mode)
+		if !ok {
+			continue
+		}
+		name, pid, err := lookup(ref)
+		if err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), fmt.Sprintf("can't join %s namespace of container %s", kind.name, ref), err)
+		}
+		n.setMode(kind.name, namespaceModePrefix+name)
+		n.joinPids[kind.name] = pid
+	}
+	return nil
+}
+
+func (n *Namespaces) setMode(kind, mode string) {
+	switch kind {
+	case "ipc":
+		n.Ipc = mode
+	case "uts":
+		n.Uts = mode
+	case "net":
+		n.Net = mode
+	case "pid":
+		n.Pid = mode
+	}
+}
+
+/**
+ * 加入的容器 pid，未加入时返回空
+ */
+func (n *Namespaces) JoinPid(kind string) string {
+	return n.joinPids[kind]
+}
+
+/**
+ * 需要新建的 namespace 对应的 clone flag，mount namespace 始终新建
+ */
+func (n *Namespaces) CloneFlags() uintptr {
+	flags := uintptr(unix.CLONE_NEWNS)
+	for _, kind := range n.kinds() {
+		if IsPrivateNamespace(kind.mode) {
+			flags |= kind.flag
+		}
+	}
+	return flags
+}
+
+/**
+ * 子进程需要加入的 ipc、uts、net namespace 文件
+ */
+func (n *Namespaces) joinPaths() []string {
+	var paths []string
+	for _, kind := range n.kinds() {
+		if pid := n.joinPids[kind.name]; pid != "" && kind.name != "pid" {
+			paths = append(paths, fmt.Sprintf("/proc/%s/ns/%s", pid, kind.name))
+		}
+	}
+	return paths
+}
+
+/**
+ * 启动容器进程，加入其它容器的 pid namespace 时在当前线程 setns 后 clone
+ * setns pid namespace 只影响之后创建的子进程，线程不再解锁，goroutine 结束时随之退出
+ */
+func StartParentProcess(cmd *exec.Cmd, namespaces *Namespaces) error {
+	pid := namespaces.JoinPid("pid")
+	if pid == "" {
+		return cmd.Start()
+	}
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		nsPath := fmt.Sprintf("/proc/%s/ns/pid", pid)
+		fd, err := unix.Open(nsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			result <- meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("open %s failed", nsPath), err)
+			return
+		}
+		defer unix.Close(fd)
+		if err := unix.Setns(fd, unix.CLONE_NEWPID); err != nil {
+			result <- meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("setns %s failed", nsPath), err)
+			return
+		}
+		result <- cmd.Start()
+	}()
+	return <-result
+}
@@ -0,0 +1,55 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseTimeOffsets(t *testing.T) {
+	offsets, err := ParseTimeOffsets("monotonic=86400,boottime=-1.5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TimeOffset{
+		{Clock: "monotonic", Seconds: 86400},
+		{Clock: "boottime", Seconds: -2, Nanoseconds: 500000000},
+	}
+	if !reflect.DeepEqual(offsets, expected) {
+		t.Fatalf("unexpected offsets %v", offsets)
+	}
+	for _, invalid := range []string{"realtime=1", "monotonic", "boottime=abc"} {
+		if _, err := ParseTimeOffsets(invalid); err == nil {
+			t.Fatalf("expected error for %s", invalid)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	namespaces := &Namespaces{Pid: "container:web", Ipc: "container:web", Net: NamespaceModeHost}
+	if err := namespaces.Validate(false); err != nil {
+		t.Fatal(err)
+	}
+	if flags := namespaces.CloneFlags(); flags != unix.CLONE_NEWNS|unix.CLONE_NEWUTS {
+		t.Fatalf("unexpected clone flags %#x", flags)
+	}
+	if deps := namespaces.Dependencies(); !reflect.DeepEqual(deps, []string{"web"}) {
+		t.Fatalf("unexpected dependencies %v", deps)
+	}
+	if err := namespaces.Resolve(func(string) (string, string, error) { return "web-full", "42", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces.Pid != "container:web-full" || namespaces.Ipc != "container:web-full" {
+		t.Fatalf("unexpected resolved modes %s %s", namespaces.Pid, namespaces.Ipc)
+	}
+	if paths := namespaces.joinPaths(); !reflect.DeepEqual(paths, []string{"/proc/42/ns/ipc"}) {
+		t.Fatalf("unexpected join paths %v", paths)
+	}
+	if err := namespaces.Validate(true); err == nil {
+		t.Fatal("expected rootless error")
+	}
+	if err := (&Namespaces{Uts: "container:"}).Validate(false); err == nil {
+		t.Fatal("expected invalid mode error")
+	}
+}
@@ -0,0 +1,84 @@
+package container
+
+import "path"
+
+/**
+ * directories of images, container workspaces and container state, resolved from --root, --state or config file
+ * 1.Root holds image tarballs and metadata (images) and lower/upper/work/merged directories of each container;
+ * 2.State holds container records (json), container logs (log) and pod records (pod);
+ * every function touching these directories takes a Paths instead of reading package state
+ * Usage: paths := container.NewPaths(cfg.Root, cfg.State)
+ */
+type Paths struct {
+	Root  string
+	State string
+}
+
+func NewPaths(root, state string) *Paths {
+	return &Paths{Root: path.Clean(root), State: path.Clean(state)}
+}
+
+// directory of container records, one sub directory per container
+func (p *Paths) StateRoot() string {
+	return path.Join(p.State, "json")
+}
+
+// state directory of a container, also holds etc files and slirp4netns pid
+func (p *Paths) StateDir(containerName string) string {
+	return path.Join(p.StateRoot(), containerName)
+}
+
+// directory of container logs, one sub directory per detached container
+func (p *Paths) LogRoot() string {
+	return path.Join(p.State, "log")
+}
+
+func (p *Paths) LogDir(containerName string) string {
+	return path.Join(p.LogRoot(), containerName)
+}
+
+func (p *Paths) LogFile(containerName string) string {
+	return path.Join(p.LogDir(containerName), LogFileName)
+}
+
+// directory of pod records, one sub directory per pod
+func (p *Paths) PodRoot() string {
+	return path.Join(p.State, "pod")
+}
+
+func (p *Paths) PodDir(podName string) string {
+	return path.Join(p.PodRoot(), podName)
+}
+
+// directory of image tarballs, metadata and temporary files of commit, only mydocker writes here
+func (p *Paths) ImageRoot() string {
+	return path.Join(p.Root, "images")
+}
+
+func (p *Paths) ImagePath(imageName string) string {
+	return path.Join(p.ImageRoot(), imageName+".tar")
+}
+
+func (p *Paths) imageMetaPath(imageName string) string {
+	return path.Join(p.ImageRoot(), imageName+".json")
+}
+
+func (p *Paths) imageTmpPath(imageName string) string {
+	return p.ImagePath(imageName) + imageTmpSuffix
+}
+
+func (p *Paths) lower(containerName string) string {
+	return path.Join(p.Root, containerName, "lower")
+}
+
+func (p *Paths) upper(containerName string) string {
+	return path.Join(p.Root, containerName, "upper")
+}
+
+func (p *Paths) worker(containerName string) string {
+	return path.Join(p.Root, containerName, "work")
+}
+
+func (p *Paths) merged(containerName string) string {
+	return path.Join(p.Root, containerName, "merged")
+}
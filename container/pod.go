@@ -0,0 +1,132 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * pod：共享 net、ipc、uts namespace 的一组容器
+ * 1.infra 容器运行 pause 进程持有 namespace，记录为普通容器，网络、hosts、端口映射都挂在 infra 容器上；
+ * 2.pod 内容器以 container:<infra> 模式加入 infra 容器的 namespace；
+ * 3.pod 拥有父 cgroup，infra 与各容器的 cgroup 位于其下；
+ * Usage: ./Mydocker pod create --net testnet -p 8080:80 web
+ *        ./Mydocker run --pod web -d busybox top
+ */
+
+/**
+ * pod 信息记录
+ */
+type Pod struct {
+	Id             string            `json:"id"`             //pod Id
+	Name           string            `json:"name"`           //pod 名
+	InfraContainer string            `json:"infraContainer"` //infra 容器名
+	Network        string            `json:"network"`        //pod 连接的网络
+	PortMapping    []string          `json:"portmapping"`    //pod 端口映射
+	CgroupParent   string            `json:"cgroupParent"`   //pod 父 cgroup
+	CreateTime     string            `json:"createTime"`     //pod 创建时间
+	Labels         map[string]string `json:"labels"`         //pod 标签
+}
+
+/**
+ * infra 容器名
+ */
+func InfraContainerName(podName string) string {
+	return podName + "-infra"
+}
+
+/**
+ * 读取 pod 信息
+ */
+func LoadPod(paths *Paths, podName string) (*Pod, error) {
+	podPath := path.Join(paths.PodDir(podName), PodConfig)
+	content, err := ioutil.ReadFile(podPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), fmt.Sprintf("pod %s not found", podName), err)
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read pod %s failed", podPath), err)
+	}
+	pod := new(Pod)
+	if err := json.Unmarshal(content, pod); err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), fmt.Sprintf("unmarshal pod %s failed", podPath), err)
+	}
+	return pod, nil
+}
+
+/**
+ * 保存 pod 信息
+ */
+func (p *Pod) Dump(paths *Paths) error {
+	podDir := paths.PodDir(p.Name)
+	if err := os.MkdirAll(podDir, Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("mkdir pod dir %s failed", podDir), err)
+	}
+	content, err := json.Marshal(p)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), "marshal pod failed", err)
+	}
+	if err := ioutil.WriteFile(path.Join(podDir, PodConfig), content, Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("write pod %s failed", p.Name), err)
+	}
+	return nil
+}
+
+/**
+ * 删除 pod 信息
+ */
+func (p *Pod) Remove(paths *Paths) error {
+	podDir := paths.PodDir(p.Name)
+	if err := os.RemoveAll(podDir); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("remove pod dir %s failed", podDir), err)
+	}
+	return nil
+}
+
+/**
+ * 创建 infra 进程，新建 net、ipc、uts、mount namespace
+ * mount namespace 用于持有 pod 私有的 /dev/shm，pod 内容器通过 /proc/<pid>/root/dev/shm 共享
+ */
+func NewInfraProcess(podName string) (*exec.Cmd, error) {
+	exePath, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "can't find /proc/self/exe link", err)
+	}
+	cmd := exec.Command(exePath, "pause", podName)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWNS,
+		// 脱离当前会话，mydocker 退出后继续运行
+		Setsid: true,
+	}
+	return cmd, nil
+}
+
+/**
+ * pause 进程：设置 hostname、挂载 /dev/shm 后等待 SIGTERM/SIGINT
+ */
+func Pause(hostname string) error {
+	if err := syscall.Sethostname([]byte(hostname)); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("set hostname %s failed", hostname), err)
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
+		return meta.NewError(meta.ErrMount, "mount default namespace private failed", err)
+	}
+	shmSize, _ := ParseByteSize(DefaultShmSize)
+	if err := syscall.Mount("shm", "/dev/shm", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, fmt.Sprintf("mode=1777,size=%d", shmSize)); err != nil {
+		return meta.NewError(meta.ErrMount, "mount pod /dev/shm failed", err)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Infof("pause exit by signal %v", sig)
+	return nil
+}
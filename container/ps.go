@@ -0,0 +1,144 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 容器记录中创建、启动、退出时间的格式
+const TimeLayout = "2006-01-02 15:04:05"
+
+// ps --filter 支持的过滤条件
+const (
+	FilterStatus   = "status"
+	FilterName     = "name"
+	FilterLabel    = "label"
+	FilterNetwork  = "network"
+	FilterAncestor = "ancestor"
+)
+
+/**
+ * 解析 ps --filter key=value，status 只能是 created、running、stopped、exited
+ */
+func ParsePsFilters(filters []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid filter %s, should be key=value", f), nil)
+		}
+		switch kv[0] {
+		case FilterStatus:
+			switch kv[1] {
+			case CREATED, RUNNING, STOP, Exit:
+			default:
+				return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid filter status=%s, should be %s, %s, %s or %s", kv[1], CREATED, RUNNING, STOP, Exit), nil)
+			}
+		case FilterName, FilterLabel, FilterNetwork, FilterAncestor:
+		default:
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid filter %s, supported filters: status, name, label, network, ancestor", kv[0]), nil)
+		}
+		result[kv[0]] = append(result[kv[0]], kv[1])
+	}
+	return result, nil
+}
+
+/**
+ * 相同条件之间为或，不同条件之间为与
+ */
+func MatchPsFilters(info *Info, filters map[string][]string) bool {
+	for key, values := range filters {
+		matched := false
+		for _, value := range values {
+			if MatchPsFilter(info, key, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func MatchPsFilter(info *Info, key, value string) bool {
+	switch key {
+	case FilterStatus:
+		// stopped 与 exited 是同一状态
+		if value == Exit {
+			value = STOP
+		}
+		status := info.Status
+		if status == Exit {
+			status = STOP
+		}
+		return status == value
+	case FilterName:
+		return strings.Contains(info.Name, value)
+	case FilterLabel:
+		return MatchLabel(info.Labels, value)
+	case FilterNetwork:
+		return info.NetworkSettings.Network == value
+	case FilterAncestor:
+		return info.Image == value
+	}
+	return false
+}
+
+/**
+ * 根据记录的时间生成可读状态，例如 Up 3 minutes、Exited (1) 2 hours ago
+ * 运行时长从启动时间算起，没有启动时间的旧记录使用创建时间
+ */
+func HumanStatus(info *Info, now time.Time) string {
+	if info.Status == CREATED {
+		return "Created"
+	}
+	if info.Status == RUNNING {
+		startedAt := info.StartedAt
+		if startedAt == "" {
+			startedAt = info.CreateTime
+		}
+		started, err := time.ParseInLocation(TimeLayout, startedAt, time.Local)
+		if err != nil {
+			return "Up"
+		}
+		return "Up " + HumanDuration(now.Sub(started))
+	}
+	finished, err := time.ParseInLocation(TimeLayout, info.FinishedAt, time.Local)
+	if err != nil {
+		return fmt.Sprintf("Exited (%d)", info.ExitCode)
+	}
+	return fmt.Sprintf("Exited (%d) %s ago", info.ExitCode, HumanDuration(now.Sub(finished)))
+}
+
+func HumanDuration(d time.Duration) string {
+	if seconds := int(d.Seconds()); seconds < 1 {
+		return "Less than a second"
+	} else if seconds == 1 {
+		return "1 second"
+	} else if seconds < 60 {
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	if minutes := int(d.Minutes()); minutes == 1 {
+		return "About a minute"
+	} else if minutes < 60 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	hours := int(d.Hours())
+	switch {
+	case hours == 1:
+		return "About an hour"
+	case hours < 48:
+		return fmt.Sprintf("%d hours", hours)
+	case hours < 24*7*2:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours < 24*30*2:
+		return fmt.Sprintf("%d weeks", hours/24/7)
+	case hours < 24*365*2:
+		return fmt.Sprintf("%d months", hours/24/30)
+	}
+	return fmt.Sprintf("%d years", hours/24/365)
+}
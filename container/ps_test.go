@@ -0,0 +1,97 @@
+package container
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePsFilters(t *testing.T) {
+	filters, err := ParsePsFilters([]string{"status=created", "status=exited", "label=env=prod", "name=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters[FilterStatus]) != 2 || filters[FilterLabel][0] != "env=prod" || filters[FilterName][0] != "web" {
+		t.Fatalf("unexpected filters %v", filters)
+	}
+	for _, invalid := range []string{"status=paused", "status=", "name", "id=abc"} {
+		if _, err := ParsePsFilters([]string{invalid}); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestMatchPsFilters(t *testing.T) {
+	info := &Info{
+		Name:            "web-1",
+		Status:          Exit,
+		Image:           "busybox",
+		Labels:          map[string]string{"env": "prod"},
+		NetworkSettings: NetworkSettings{Network: "testnet"},
+	}
+	cases := []struct {
+		filters  []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"status=stopped"}, true},
+		{[]string{"status=exited"}, true},
+		{[]string{"status=created"}, false},
+		{[]string{"status=running", "status=exited"}, true},
+		{[]string{"name=web"}, true},
+		{[]string{"name=db"}, false},
+		{[]string{"label=env"}, true},
+		{[]string{"label=env=dev"}, false},
+		{[]string{"network=testnet", "ancestor=busybox"}, true},
+		{[]string{"network=testnet", "ancestor=redis"}, false},
+	}
+	for _, c := range cases {
+		filters, err := ParsePsFilters(c.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := MatchPsFilters(info, filters); got != c.expected {
+			t.Fatalf("filters %v: expected %v, got %v", c.filters, c.expected, got)
+		}
+	}
+}
+
+func TestHumanStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	cases := []struct {
+		info     Info
+		expected string
+	}{
+		{Info{Status: CREATED, CreateTime: "2024-01-01 11:00:00"}, "Created"},
+		// created an hour ago, started 3 minutes ago
+		{Info{Status: RUNNING, CreateTime: "2024-01-01 11:00:00", StartedAt: "2024-01-01 11:57:00"}, "Up 3 minutes"},
+		// records without start time
+		{Info{Status: RUNNING, CreateTime: "2024-01-01 11:00:00"}, "Up About an hour"},
+		{Info{Status: Exit, ExitCode: 137, FinishedAt: "2024-01-01 11:59:58"}, "Exited (137) 2 seconds ago"},
+		{Info{Status: STOP, ExitCode: 0}, "Exited (0)"},
+	}
+	for _, c := range cases {
+		if got := HumanStatus(&c.info, now); got != c.expected {
+			t.Fatalf("status %s: expected %q, got %q", c.info.Status, c.expected, got)
+		}
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		500 * time.Millisecond:   "Less than a second",
+		time.Second:              "1 second",
+		45 * time.Second:         "45 seconds",
+		90 * time.Second:         "About a minute",
+		10 * time.Minute:         "10 minutes",
+		time.Hour:                "About an hour",
+		30 * time.Hour:           "30 hours",
+		3 * 24 * time.Hour:       "3 days",
+		21 * 24 * time.Hour:      "3 weeks",
+		90 * 24 * time.Hour:      "3 months",
+		3 * 365 * 24 * time.Hour: "3 years",
+	} {
+		if got := HumanDuration(d); got != expected {
+			t.Fatalf("duration %v: expected %q, got %q", d, expected, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 容器资源限制
+ * 1.--ulimit 在 init 进程 execve 之前通过 setrlimit 设置；
+ * 2.--oom-score-adj 写入 /proc/self/oom_score_adj；
+ * 提高 hard limit、降低 oom_score_adj 需要 CAP_SYS_RESOURCE，所以在收缩 capability 之前执行
+ * Usage: ./Mydocker run --ulimit nofile=65536:65536 --oom-score-adj 500 xxx
+ */
+
+const (
+	oomScoreAdjFile = "/proc/self/oom_score_adj"
+	OomScoreAdjMin  = -1000
+	OomScoreAdjMax  = 1000
+)
+
+// ulimit 名称与 RLIMIT_* 对应关系
+var rlimitMap = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+/**
+ * 单项资源限制
+ */
+type Rlimit struct {
+	Name string `json:"name"` //ulimit 名称，例如 nofile
+	Soft uint64 `json:"soft"` //soft limit
+	Hard uint64 `json:"hard"` //hard limit
+}
+
+/**
+ * 解析 --ulimit，格式为 name=soft[:hard]，-1 或 unlimited 表示不限制
+ * 重复指定同一项时后者覆盖前者
+ */
+func ParseUlimits(ulimits []string) ([]Rlimit, error) {
+	var result []Rlimit
+	index := map[string]int{}
+	for _, u := range ulimits {
+		kv := strings.SplitN(u, "=", 2)
+		if len(kv) != 2 {
+			return nil, invalidUlimit(u, nil)
+		}
+		name := strings.ToLower(kv[0])
+		if _, ok := rlimitMap[name]; !ok {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("unknown ulimit %s", kv[0]), nil)
+		}
+		values := strings.SplitN(kv[1], ":", 2)
+		soft, err := parseRlimitValue(values[0])
+		if err != nil {
+			return nil, invalidUlimit(u, err)
+		}
+		hard := soft
+		if len(values) == 2 {
+			if hard, err = parseRlimitValue(values[1]); err != nil {
+				return nil, invalidUlimit(u, err)
+			}
+		}
+		if soft > hard {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("ulimit %s soft limit is greater than hard limit", u), nil)
+		}
+		rlimit := Rlimit{Name: name, Soft: soft, Hard: hard}
+		if i, ok := index[name]; ok {
+			result[i] = rlimit
+			continue
+		}
+		index[name] = len(result)
+		result = append(result, rlimit)
+	}
+	return result, nil
+}
+
+func parseRlimitValue(value string) (uint64, error) {
+	if value == "-1" || value == "unlimited" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func invalidUlimit(ulimit string, err error) error {
+	return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid ulimit %s, format is name=soft[:hard]", ulimit), err)
+}
+
+/**
+ * 校验 --oom-score-adj 范围
+ */
+func ValidateOomScoreAdj(score int) error {
+	if score < OomScoreAdjMin || score > OomScoreAdjMax {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("oom-score-adj %d out of range [%d, %d]", score, OomScoreAdjMin, OomScoreAdjMax), nil)
+	}
+	return nil
+}
+
+/**
+ * 设置当前进程的资源限制，execve 后由用户进程继承
+ * syscall.Setrlimit 设置 nofile 时会通知 runtime 不再恢复启动时的 nofile
+ */
+func applyRlimits(rlimits []Rlimit) error {
+	for _, r := range rlimits {
+		limit := &syscall.Rlimit{Cur: r.Soft, Max: r.Hard}
+		if err := syscall.Setrlimit(rlimitMap[r.Name], limit); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("setrlimit %s=%d:%d failed", r.Name, r.Soft, r.Hard), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * 设置当前进程的 oom_score_adj，nil 表示保持继承的值
+ */
+func applyOomScoreAdj(score *int) error {
+	if score == nil {
+		return nil
+	}
+	if err := ioutil.WriteFile(oomScoreAdjFile, []byte(strconv.Itoa(*score)), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("write oom_score_adj %d failed", *score), err)
+	}
+	return nil
+}
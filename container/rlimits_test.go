@@ -0,0 +1,26 @@
+package container
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseUlimits(t *testing.T) {
+	rlimits, err := ParseUlimits([]string{"nofile=1024:4096", "core=-1", "NOFILE=65536"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Rlimit{
+		{Name: "nofile", Soft: 65536, Hard: 65536},
+		{Name: "core", Soft: math.MaxUint64, Hard: math.MaxUint64},
+	}
+	if !reflect.DeepEqual(rlimits, expected) {
+		t.Fatalf("unexpected rlimits %v", rlimits)
+	}
+	for _, invalid := range []string{"nofile", "unknown=1", "nofile=10:1", "nproc=abc"} {
+		if _, err := ParseUlimits([]string{invalid}); err == nil {
+			t.Fatalf("expected error for %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 容器 rootfs 加固
+ * 1.masked paths：/dev/null 覆盖敏感文件，只读 tmpfs 覆盖敏感目录；
+ * 2.readonly paths：内核接口只读重新挂载；
+ * 3.--read-only：pivot_root 之后只读重新挂载根目录，--tmpfs 提供可写目录；
+ * 特权容器不做 masked/readonly paths 限制
+ */
+
+// 默认屏蔽的内核接口，与 docker 保持一致
+var DefaultMaskedPaths = []string{
+	"/proc/asound",
+	"/proc/acpi",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// 默认只读的内核接口
+var DefaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// statfs 返回的挂载标志（linux/statfs.h）与 mount flag 对应关系
+var statfsMountFlags = map[int64]uintptr{
+	0x2:    syscall.MS_NOSUID,
+	0x4:    syscall.MS_NODEV,
+	0x8:    syscall.MS_NOEXEC,
+	0x400:  syscall.MS_NOATIME,
+	0x800:  syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+// tmpfs 默认挂载参数
+const defaultTmpfsOptions = "noexec,nosuid,nodev"
+
+// mount 参数与 flag 对应关系，其余参数作为 data 传给文件系统
+var mountOptionFlags = map[string]struct {
+	clear bool
+	flag  uintptr
+}{
+	"ro":          {false, syscall.MS_RDONLY},
+	"rw":          {true, syscall.MS_RDONLY},
+	"nosuid":      {false, syscall.MS_NOSUID},
+	"suid":        {true, syscall.MS_NOSUID},
+	"nodev":       {false, syscall.MS_NODEV},
+	"dev":         {true, syscall.MS_NODEV},
+	"noexec":      {false, syscall.MS_NOEXEC},
+	"exec":        {true, syscall.MS_NOEXEC},
+	"sync":        {false, syscall.MS_SYNCHRONOUS},
+	"async":       {true, syscall.MS_SYNCHRONOUS},
+	"noatime":     {false, syscall.MS_NOATIME},
+	"atime":       {true, syscall.MS_NOATIME},
+	"nodiratime":  {false, syscall.MS_NODIRATIME},
+	"diratime":    {true, syscall.MS_NODIRATIME},
+	"relatime":    {false, syscall.MS_RELATIME},
+	"norelatime":  {true, syscall.MS_RELATIME},
+	"strictatime": {false, syscall.MS_STRICTATIME},
+}
+
+/**
+ * 解析 mount 参数，例如 rw,noexec,size=64m 返回 MS_NOEXEC 和 size=64m
+ */
+func parseMountOptions(options string) (uintptr, string) {
+	var flags uintptr
+	var data []string
+	for _, opt := range strings.Split(options, ",") {
+		if opt == "" {
+			continue
+		}
+		if f, ok := mountOptionFlags[opt]; ok {
+			if f.clear {
+				flags &^= f.flag
+			} else {
+				flags |= f.flag
+			}
+			continue
+		}
+		data = append(data, opt)
+	}
+	return flags, strings.Join(data, ",")
+}
+
+/**
+ * 校验 --tmpfs 参数，格式为 path[:options]
+ */
+func ValidateTmpfs(tmpfs []string) error {
+	for _, t := range tmpfs {
+		dest := strings.SplitN(t, ":", 2)[0]
+		if !filepath.IsAbs(dest) {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("tmpfs destination %s must be absolute", dest), nil)
+		}
+	}
+	return nil
+}
+
+/**
+ * 挂载 tmpfs 到 rootfs 下，需要在只读挂载根目录之前完成目录创建
+ */
+func mountTmpfs(root string, tmpfs []string) error {
+	for _, t := range tmpfs {
+		parts := strings.SplitN(t, ":", 2)
+		options := defaultTmpfsOptions
+		if len(parts) == 2 {
+			options = defaultTmpfsOptions + "," + parts[1]
+		}
+		dest := filepath.Join(root, parts[0])
+		if err := os.MkdirAll(dest, Perm0755); err != nil {
+			return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir tmpfs %s failed", dest), err)
+		}
+		flags, data := parseMountOptions(options)
+		if err := syscall.Mount("tmpfs", dest, "tmpfs", flags, data); err != nil {
+			return meta.NewError(meta.ErrMount, fmt.Sprintf("mount tmpfs %s failed", dest), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * 屏蔽敏感路径，文件使用 /dev/null 覆盖，目录使用只读 tmpfs 覆盖
+ * 在 pivot_root 之前执行，此时宿主机 /dev/null 仍然可见
+ */
+func maskPaths(root string, paths []string) error {
+	for _, p := range paths {
+		target := filepath.Join(root, p)
+		fi, err := os.Stat(target)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return meta.NewError(meta.ErrRead, fmt.Sprintf("stat masked path %s failed", target), err)
+		}
+		if fi.IsDir() {
+			err = syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_RDONLY, "")
+		} else {
+			err = syscall.Mount("/dev/null", target, "bind", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return meta.NewError(meta.ErrMount, fmt.Sprintf("mask path %s failed", target), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * 只读挂载内核接口：bind 到自身后只读重新挂载
+ */
+func readonlyPaths(root string, paths []string) error {
+	for _, p := range paths {
+		target := filepath.Join(root, p)
+		if err := syscall.Mount(target, target, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return meta.NewError(meta.ErrMount, fmt.Sprintf("bind readonly path %s failed", target), err)
+		}
+		if err := remountReadonly(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 只读重新挂载，user namespace 中 nosuid、nodev、noexec 等标志被锁定，必须保留原有标志
+ */
+func remountReadonly(target string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return meta.NewError(meta.ErrRead, fmt.Sprintf("statfs %s failed", target), err)
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	for statfsFlag, mountFlag := range statfsMountFlags {
+		if int64(st.Flags)&statfsFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return meta.NewError(meta.ErrMount, fmt.Sprintf("remount %s readonly failed", target), err)
+	}
+	log.Infof("rootfs::remountReadonly %s", target)
+	return nil
+}
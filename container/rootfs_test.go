@@ -0,0 +1,19 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	flags, data := parseMountOptions(defaultTmpfsOptions + ",exec,size=64m,mode=1777")
+	if flags != syscall.MS_NOSUID|syscall.MS_NODEV {
+		t.Fatalf("unexpected flags %#x", flags)
+	}
+	if data != "size=64m,mode=1777" {
+		t.Fatalf("unexpected data %s", data)
+	}
+	if err := ValidateTmpfs([]string{"/run:size=1m", "tmp"}); err == nil {
+		t.Fatal("expected relative tmpfs destination error")
+	}
+}
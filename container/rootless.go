@@ -0,0 +1,207 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * rootless mode: mydocker is executed by an unprivileged user
+ * 1.container process is created inside a new user namespace, uid/gid are mapped by newuidmap/newgidmap;
+ * 2.overlayfs is mounted by the container init inside the user namespace (fuse-overlayfs/vfs as fallback);
+ * 3.state and image directories are located under $XDG_RUNTIME_DIR/$HOME;
+ */
+
+// environments used to transfer rootless configuration from parentProcess to init process
+const (
+	EnvRootless        = "MYDOCKER_ROOTLESS"
+	EnvUserNSReady     = "MYDOCKER_USERNS_READY"
+	EnvRootlessOverlay = "MYDOCKER_ROOTLESS_OVERLAY"
+	EnvRootlessVolume  = "MYDOCKER_ROOTLESS_VOLUME"
+)
+
+const (
+	subUidFile       = "/etc/subuid"
+	subGidFile       = "/etc/subgid"
+	userNSWaitPeriod = 10 * time.Millisecond
+	userNSWaitTimes  = 1000
+)
+
+/**
+ * IsRootless reports whether mydocker runs without root privileges
+ * state directory is under $XDG_RUNTIME_DIR and image directory under $XDG_DATA_HOME by default in rootless mode
+ */
+func IsRootless() bool {
+	return os.Geteuid() != 0
+}
+
+/**
+ * write uid_map/gid_map of container process
+ * 1.use newuidmap/newgidmap with ranges of /etc/subuid、/etc/subgid if configured;
+ * 2.otherwise only map current user to root of container;
+ * gid_map is written before uid_map, init process waits for uid_map as the signal of ready
+ */
+func SetupUserNamespace(pid int) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	u, err := user.Current()
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "lookup current user failed", err)
+	}
+	subGid, gidErr := lookupSubIDRange(subGidFile, u.Username, gid)
+	subUid, uidErr := lookupSubIDRange(subUidFile, u.Username, uid)
+	if gidErr == nil && uidErr == nil {
+		if err := newIDMap("newgidmap", pid, gid, subGid); err != nil {
+			return err
+		}
+		return newIDMap("newuidmap", pid, uid, subUid)
+	}
+	log.Warnf("rootless::SetupUserNamespace subordinate ids unavailable, map current user only: %v %v", gidErr, uidErr)
+	procDir := fmt.Sprintf("/proc/%d/", pid)
+	if err := ioutil.WriteFile(procDir+"setgroups", []byte("deny"), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "write setgroups failed", err)
+	}
+	if err := ioutil.WriteFile(procDir+"gid_map", []byte(fmt.Sprintf("0 %d 1", gid)), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "write gid_map failed", err)
+	}
+	if err := ioutil.WriteFile(procDir+"uid_map", []byte(fmt.Sprintf("0 %d 1", uid)), Perm0644); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "write uid_map failed", err)
+	}
+	return nil
+}
+
+/**
+ * subordinate id range of /etc/subuid or /etc/subgid
+ */
+type subIDRange struct {
+	Start int
+	Count int
+}
+
+/**
+ * find subordinate id range of user by name or id
+ * format of each line: name_or_id:start:count
+ */
+func lookupSubIDRange(file, name string, id int) (*subIDRange, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Split(strings.TrimSpace(sc.Text()), ":")
+		if len(parts) != 3 || (parts[0] != name && parts[0] != strconv.Itoa(id)) {
+			continue
+		}
+		start, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, meta.NewError(meta.ErrConvert, fmt.Sprintf("parse %s start failed", file), err)
+		}
+		count, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, meta.NewError(meta.ErrConvert, fmt.Sprintf("parse %s count failed", file), err)
+		}
+		return &subIDRange{Start: start, Count: count}, nil
+	}
+	return nil, fmt.Errorf("no entry for %s in %s", name, file)
+}
+
+/**
+ * Usage: newuidmap <pid> 0 <uid> 1 1 <subuid> <count>
+ */
+func newIDMap(tool string, pid, id int, sub *subIDRange) error {
+	cmd := exec.Command(tool, strconv.Itoa(pid), "0", strconv.Itoa(id), "1",
+		"1", strconv.Itoa(sub.Start), strconv.Itoa(sub.Count))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("%s failed: %s", tool, output), err)
+	}
+	return nil
+}
+
+/**
+ * init process is created without uid mapping, so all capabilities are dropped by execve
+ * wait until parentProcess writes uid_map, then re-exec as root of user namespace to regain capabilities
+ */
+func reexecInUserNamespace() error {
+	for i := 0; i < userNSWaitTimes; i++ {
+		content, err := ioutil.ReadFile("/proc/self/uid_map")
+		if err == nil && len(strings.TrimSpace(string(content))) > 0 {
+			env := append(os.Environ(), EnvUserNSReady+"=1")
+			return syscall.Exec("/proc/self/exe", []string{os.Args[0], "init"}, env)
+		}
+		time.Sleep(userNSWaitPeriod)
+	}
+	return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "wait for uid_map timeout", nil)
+}
+
+/**
+ * mount container rootfs inside user namespace
+ * 1.kernel overlayfs(>= 5.11);
+ * 2.fuse-overlayfs;
+ * 3.vfs: copy lower-dir into merged-dir;
+ */
+func mountRootlessWorkSpace() error {
+	merged, err := os.Getwd()
+	if err != nil {
+		return meta.NewError(meta.ErrRead, "get current location failed", err)
+	}
+	dirs := os.Getenv(EnvRootlessOverlay)
+	if err := syscall.Mount("overlay", merged, "overlay", 0, dirs+",userxattr"); err != nil {
+		log.Warnf("rootless::mountRootlessWorkSpace kernel overlayfs failed %v, try fuse-overlayfs", err)
+		if output, err := exec.Command("fuse-overlayfs", "-o", dirs, merged).CombinedOutput(); err != nil {
+			log.Warnf("rootless::mountRootlessWorkSpace fuse-overlayfs failed %v %s, fallback to vfs", err, output)
+			lower := strings.TrimPrefix(strings.Split(dirs, ",")[0], "lowerdir=")
+			if output, err := exec.Command("cp", "-a", lower+"/.", merged).CombinedOutput(); err != nil {
+				return meta.NewError(meta.ErrWrite, fmt.Sprintf("copy rootfs failed: %s", output), err)
+			}
+		}
+	}
+	// enter the new mount instead of the underlying directory
+	if err := syscall.Chdir(merged); err != nil {
+		return meta.NewError(meta.ErrMount, "change working directory failed", err)
+	}
+	volume := os.Getenv(EnvRootlessVolume)
+	if volume == "" {
+		return nil
+	}
+	hostDir, containerDir, err := volumeUrlExtract(volume)
+	if err != nil {
+		return err
+	}
+	containerVolumeUrl := path.Join(merged, containerDir)
+	if err := os.MkdirAll(containerVolumeUrl, Perm0755); err != nil {
+		return meta.NewError(meta.ErrWrite, fmt.Sprintf("mkdir container dir %s failed", containerVolumeUrl), err)
+	}
+	if err := syscall.Mount(hostDir, containerVolumeUrl, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return meta.NewError(meta.ErrMount, fmt.Sprintf("mount volume %s failed", volume), err)
+	}
+	return nil
+}
+
+/**
+ * environments of user process, without configuration used by init process
+ */
+func containerEnviron() []string {
+	envs := make([]string, 0, len(os.Environ()))
+	for _, env := range os.Environ() {
+		key := strings.SplitN(env, "=", 2)[0]
+		switch key {
+		case EnvRootless, EnvUserNSReady, EnvRootlessOverlay, EnvRootlessVolume, EnvJoinNamespaces:
+			continue
+		}
+		envs = append(envs, env)
+	}
+	return envs
+}
@@ -0,0 +1,26 @@
+package container
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestLookupSubIDRange(t *testing.T) {
+	file := path.Join(t.TempDir(), "subuid")
+	content := "alice:100000:65536\n1001:165536:65536\n"
+	if err := ioutil.WriteFile(file, []byte(content), Perm0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := lookupSubIDRange(file, "alice", 1000)
+	if err != nil || r.Start != 100000 || r.Count != 65536 {
+		t.Fatalf("lookup by name: %v %v", r, err)
+	}
+	r, err = lookupSubIDRange(file, "bob", 1001)
+	if err != nil || r.Start != 165536 {
+		t.Fatalf("lookup by id: %v %v", r, err)
+	}
+	if _, err = lookupSubIDRange(file, "carol", 1002); err == nil {
+		t.Fatal("expected missing entry error")
+	}
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * 容器内核参数
+ * 只允许设置属于容器私有 namespace 的参数，避免修改宿主机全局配置：
+ * 1.ipc namespace：kernel.shm*、kernel.msg*、kernel.sem、fs.mqueue.*；
+ * 2.net namespace：net.*；
+ * 在 pivot_root 之前写入新挂载的 proc，之后 /proc/sys 会被只读挂载
+ * Usage: ./Mydocker run --sysctl net.core.somaxconn=1024 xxx
+ */
+
+// ipc namespace 隔离的参数
+var ipcNamespacedSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+/**
+ * 解析并校验 --sysctl，格式为 key=value，privateNet、privateIPC 表示容器是否拥有独立的 net、ipc namespace
+ */
+func ParseSysctls(sysctls []string, privateNet, privateIPC bool) (map[string]string, error) {
+	result := map[string]string{}
+	for _, s := range sysctls {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("invalid sysctl %s, format is key=value", s), nil)
+		}
+		// 兼容 net/core/somaxconn 形式
+		key := strings.Replace(kv[0], "/", ".", -1)
+		if err := validateSysctl(key, privateNet, privateIPC); err != nil {
+			return nil, err
+		}
+		result[key] = kv[1]
+	}
+	return result, nil
+}
+
+func validateSysctl(key string, privateNet, privateIPC bool) error {
+	switch {
+	case ipcNamespacedSysctls[key] || strings.HasPrefix(key, "fs.mqueue."):
+		if !privateIPC {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("sysctl %s is not allowed when sharing ipc namespace", key), nil)
+		}
+	case strings.HasPrefix(key, "net."):
+		if !privateNet {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("sysctl %s is not allowed when sharing network namespace", key), nil)
+		}
+	default:
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.CONTAINER), fmt.Sprintf("sysctl %s is not namespaced", key), nil)
+	}
+	return nil
+}
+
+/**
+ * 写入内核参数，procDir 为容器 proc 挂载点
+ */
+func applySysctls(procDir string, sysctls map[string]string) error {
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sysctlPath := filepath.Join(procDir, "sys", strings.Replace(key, ".", "/", -1))
+		if err := ioutil.WriteFile(sysctlPath, []byte(sysctls[key]), Perm0644); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("set sysctl %s=%s failed", key, sysctls[key]), err)
+		}
+	}
+	return nil
+}
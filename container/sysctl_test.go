@@ -0,0 +1,30 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSysctls(t *testing.T) {
+	sysctls, err := ParseSysctls([]string{"net/core/somaxconn=1024", "kernel.shmmax=68719476736", "fs.mqueue.msg_max=100"}, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"net.core.somaxconn": "1024",
+		"kernel.shmmax":      "68719476736",
+		"fs.mqueue.msg_max":  "100",
+	}
+	if !reflect.DeepEqual(sysctls, expected) {
+		t.Fatalf("unexpected sysctls %v", sysctls)
+	}
+	if _, err := ParseSysctls([]string{"kernel.hostname=foo"}, true, true); err == nil {
+		t.Fatal("expected not namespaced error")
+	}
+	if _, err := ParseSysctls([]string{"net.ipv4.ip_forward=1"}, false, true); err == nil {
+		t.Fatal("expected host network error")
+	}
+	if _, err := ParseSysctls([]string{"kernel.msgmax=1"}, true, false); err == nil {
+		t.Fatal("expected host ipc error")
+	}
+}
@@ -3,12 +3,15 @@ package container
 import (
 	"Mydockker/meta"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 /**
@@ -17,33 +20,80 @@ import (
  * 2）create upper-dir、work-dir；
  * 3）create merged-dir and mount as overlayFS；
  * 4）mount volume if exists；
+ * in rootless mode overlayfs and volume are mounted by init process inside user namespace
+ * on failure everything created so far is removed
+ * bind mount in mounts whose host dir is created here is marked Created
  */
-func NewWorkSpace(volume, imageName, containerName string) {
-	if err := createLower(imageName, containerName); err != nil {
-		log.Error(err)
-		return
+func NewWorkSpace(paths *Paths, volume, imageName, containerName string, mounts []Mount) error {
+	if err := createLower(paths, imageName, containerName); err != nil {
+		removeWorkSpaceDirs(paths, containerName)
+		return err
 	}
-	if err := createDirs(containerName); err != nil {
-		log.Error(err)
-		return
+	if err := createDirs(paths, containerName); err != nil {
+		removeWorkSpaceDirs(paths, containerName)
+		return err
 	}
-	if err := mountOverlayfs(containerName); err != nil {
-		log.Error(err)
-		return
+	if IsRootless() {
+		created, err := createRootlessDirs(paths, volume, containerName)
+		if err != nil {
+			removeWorkSpaceDirs(paths, containerName)
+			return err
+		}
+		markVolumeCreated(mounts, volume, created)
+		return nil
+	}
+	if err := mountOverlayfs(paths, containerName); err != nil {
+		removeWorkSpaceDirs(paths, containerName)
+		return err
 	}
 	if volume != "" {
 		hostDir, containerDir, err := volumeUrlExtract(volume)
+		created := false
+		if err == nil {
+			created, err = mountVolume(paths, containerName, []string{hostDir, containerDir})
+		}
 		if err != nil {
-			log.Errorf("Invalid volume %s", volume)
-			return
+			if uerr := unmountOverlayfs(paths, containerName); uerr != nil {
+				log.Errorf("volume::NewWorkSpace unmount overlayfs failed %v", uerr)
+			}
+			removeWorkSpaceDirs(paths, containerName)
+			return meta.NewError(meta.ErrMount, fmt.Sprintf("Mount volume %s failed", volume), err)
 		}
-		if err := mountVolume(containerName, []string{hostDir, containerDir}); err != nil {
-			log.Errorf("Mount volume %s failed", volume)
-			return
+		markVolumeCreated(mounts, volume, created)
+	}
+	return nil
+}
+
+/**
+ * mark the bind mount of volume whose host dir is created by mydocker
+ */
+func markVolumeCreated(mounts []Mount, volume string, created bool) {
+	if !created {
+		return
+	}
+	hostDir, _, err := volumeUrlExtract(volume)
+	if err != nil {
+		return
+	}
+	for i := range mounts {
+		if mounts[i].Type == "bind" && mounts[i].Source == hostDir {
+			mounts[i].Created = true
 		}
 	}
 }
 
+/**
+ * remove directories of a partially created workspace
+ */
+func removeWorkSpaceDirs(paths *Paths, containerName string) {
+	if err := os.RemoveAll(paths.merged(containerName)); err != nil {
+		log.Errorf("Remove mountDir %s failed %v", paths.merged(containerName), err)
+	}
+	if err := removeDirs(paths, containerName); err != nil {
+		log.Error(err)
+	}
+}
+
 /**
  * parse mount information,
  */
@@ -58,22 +108,46 @@ func volumeUrlExtract(volume string) (sourcePath string, destinationPath string,
 	return parts[0], parts[1], nil
 }
 
+/**
+ * build mount records of volume and tmpfs for containerInfo
+ */
+func ContainerMounts(volume string, tmpfs []string) []Mount {
+	var mounts []Mount
+	if volume != "" {
+		if hostDir, containerDir, err := volumeUrlExtract(volume); err == nil {
+			mounts = append(mounts, Mount{Type: "bind", Source: hostDir, Destination: containerDir, Options: "bind"})
+		}
+	}
+	for _, t := range tmpfs {
+		parts := strings.SplitN(t, ":", 2)
+		options := defaultTmpfsOptions
+		if len(parts) == 2 {
+			options = defaultTmpfsOptions + "," + parts[1]
+		}
+		mounts = append(mounts, Mount{Type: "tmpfs", Source: "tmpfs", Destination: parts[0], Options: options})
+	}
+	return mounts
+}
+
 /**
  * mount volumes of parent-dir to container-dir
+ * returns whether parent-dir is created here
  */
-func mountVolume(containerName string, volumes []string) error {
+func mountVolume(paths *Paths, containerName string, volumes []string) (bool, error) {
 	// create parent-dir
 	parentUrl := volumes[0]
+	created := true
 	if err := os.Mkdir(parentUrl, Perm0755); err != nil {
+		created = false
 		log.Infof("mkdir parent dir %s failed. %v", parentUrl, err)
 	}
 	containerUrl := volumes[1]
 	// create container's exact mount-dir $mntPath/$containerUrl
-	mntUrl := getMerged(containerName)
+	mntUrl := paths.merged(containerName)
 	containerVolumeUrl := mntUrl + "/" + containerUrl
 	if err := os.Mkdir(containerVolumeUrl, Perm0755); err != nil {
 		log.Errorf("mkdir container dir %s failed. %v", containerVolumeUrl, err)
-		return fmt.Errorf("Mkdir container-dir %s failed", containerVolumeUrl)
+		return created, fmt.Errorf("Mkdir container-dir %s failed", containerVolumeUrl)
 	}
 	// bind mount parent-dir to container-dir
 	// Usage: mount -o bind /hostUrl /containerUrl
@@ -81,23 +155,23 @@ func mountVolume(containerName string, volumes []string) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		log.Errorf("mount volume failed. %v", err)
+		return created, meta.NewError(meta.ErrMount, fmt.Sprintf("Bind mount %s to %s failed", parentUrl, containerVolumeUrl), err)
 	}
 	log.Infof("mountVolume from %s to %s successfully", parentUrl, containerVolumeUrl)
-	return nil
+	return created, nil
 }
 
 /**
  * create readOnly directory of lower-dir
  */
-func createLower(imageName, containerName string) error {
+func createLower(paths *Paths, imageName, containerName string) error {
 	// concat imagePath and target-untar position
-	imageUrl := getImage(imageName)
-	lower := getLower(containerName)
+	imageUrl := paths.ImagePath(imageName)
+	lower := paths.lower(containerName)
 	_, err := os.Stat(lower)
 	if err != nil && os.IsNotExist(err) {
 		log.Warnf("lower-dir %s not exists, imageTarUrl %s", lower, imageUrl)
-		if err = os.MkdirAll(lower, Perm0622); err != nil {
+		if err = os.MkdirAll(lower, Perm0755); err != nil {
 			return meta.NewError(meta.ErrWrite, fmt.Sprintf("Create lower-dir %s failed", lower), err)
 		}
 		if _, err := exec.Command("tar", "-xvf", imageUrl, "-C", lower).CombinedOutput(); err != nil {
@@ -110,35 +184,60 @@ func createLower(imageName, containerName string) error {
 /**
  * create upper-dir and work-dir of overlayFS
  */
-func createDirs(containerName string) error {
-	upperUrl := getUpper(containerName)
+func createDirs(paths *Paths, containerName string) error {
+	upperUrl := paths.upper(containerName)
 	if err := os.MkdirAll(upperUrl, Perm0755); err != nil {
 		return meta.NewError(meta.ErrWrite, fmt.Sprintf("Create upper-dir %s failed", upperUrl), err)
 	}
-	workUrl := getWorker(containerName)
+	workUrl := paths.worker(containerName)
 	if err := os.Mkdir(workUrl, Perm0755); err != nil {
 		return meta.NewError(meta.ErrWrite, fmt.Sprintf("Create work-dir %s failed", workUrl), err)
 	}
 	return nil
 }
 
+/**
+ * create merged-dir and volume host-dir which are mounted by init process in rootless mode
+ * returns whether volume host-dir is created here
+ */
+func createRootlessDirs(paths *Paths, volume, containerName string) (bool, error) {
+	mntUrl := paths.merged(containerName)
+	if err := os.MkdirAll(mntUrl, Perm0777); err != nil {
+		return false, meta.NewError(meta.ErrWrite, fmt.Sprintf("Mkdir mntUrl %s failed", mntUrl), err)
+	}
+	if volume == "" {
+		return false, nil
+	}
+	hostDir, _, err := volumeUrlExtract(volume)
+	if err != nil {
+		return false, meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("Invalid volume %s", volume), err)
+	}
+	if _, err := os.Stat(hostDir); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(hostDir, Perm0755); err != nil {
+		return false, meta.NewError(meta.ErrWrite, fmt.Sprintf("Mkdir volume host-dir %s failed", hostDir), err)
+	}
+	return true, nil
+}
+
 /**
  * mountOverlayFS
  * mount -t overlay overlay -o lowerdir=lower1:lower2:lower3,upperdir=upper,workdir=work merged
  */
-func mountOverlayfs(containerName string) error {
+func mountOverlayfs(paths *Paths, containerName string) error {
 	// create mount-url
-	mntUrl := fmt.Sprintf(MergedDirFormat, containerName)
+	mntUrl := paths.merged(containerName)
 	if err := os.MkdirAll(mntUrl, Perm0777); err != nil {
 		return meta.NewError(meta.ErrWrite, fmt.Sprintf("Mkdir mntUrl %s failed", mntUrl), err)
 	}
 	// combine arguments
 	// e.g. lowerdir=/root/busybox,upperdir=/root/upper,workdir=/root/work
 	var (
-		lower  = getLower(containerName)
-		upper  = getUpper(containerName)
-		worker = getWorker(containerName)
-		merged = getMerged(containerName)
+		lower  = paths.lower(containerName)
+		upper  = paths.upper(containerName)
+		worker = paths.worker(containerName)
+		merged = paths.merged(containerName)
 	)
 	dirs := getOverlayFSDirs(lower, upper, worker)
 	cmd := exec.Command("mount", "-t", "overlay", "overlay", "-o", dirs, merged)
@@ -164,24 +263,31 @@ func getOverlayFSDirs(lower, upper, worker string) string {
  * 1）uninstall volume；
  * 2）uninstall and delete merged directory；
  * 3）uninstall and delete upper-dir、work-dir；
+ * in rootless mode mounts belong to container's mount namespace and disappear with it
  */
-func DeleteWorkSpace(volume, containerName string) error {
+func DeleteWorkSpace(paths *Paths, volume, containerName string) error {
 	log.Infof("DeleteWorkSpace, volume:%s, containerName:%s", volume, containerName)
+	if IsRootless() {
+		if err := os.RemoveAll(paths.merged(containerName)); err != nil {
+			log.Errorf("Remove mountDir %s failed %v", paths.merged(containerName), err)
+		}
+		return removeDirs(paths, containerName)
+	}
 	if volume != "" {
 		_, containerPath, err := volumeUrlExtract(volume)
 		if err != nil {
 			return meta.NewError(meta.ErrRead, fmt.Sprintf("Extract volume failed, volume : %s", volume), err)
 		}
-		mntPath := getMerged(containerName)
+		mntPath := paths.merged(containerName)
 		if err := unmountVolume(mntPath, containerPath); err != nil {
 			return meta.NewError(meta.ErrUnMount, fmt.Sprintf("UnmountVolume %s failed", mntPath+containerPath), err)
 		}
 	}
-	if err := unmountOverlayfs(containerName); err != nil {
+	if err := unmountOverlayfs(paths, containerName); err != nil {
 		log.Error(err)
 		return err
 	}
-	if err := removeDirs(containerName); err != nil {
+	if err := removeDirs(paths, containerName); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -205,8 +311,8 @@ func unmountVolume(mntUrl, containerPath string) error {
 /**
  * unmount merged-dir of overlayfs
  */
-func unmountOverlayfs(containerName string) error {
-	mntUrl := getMerged(containerName)
+func unmountOverlayfs(paths *Paths, containerName string) error {
+	mntUrl := paths.merged(containerName)
 	cmd := exec.Command("umount", mntUrl)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -224,10 +330,10 @@ func unmountOverlayfs(containerName string) error {
 /**
  * remove directories(merged-dir、upper-dir、work-dir) but save (lower-dir)
  */
-func removeDirs(containerName string) error {
-	lower := getLower(containerName)
-	upper := getUpper(containerName)
-	worker := getWorker(containerName)
+func removeDirs(paths *Paths, containerName string) error {
+	lower := paths.lower(containerName)
+	upper := paths.upper(containerName)
+	worker := paths.worker(containerName)
 	if err := os.RemoveAll(upper); err != nil {
 		return fmt.Errorf("Remove lower-dir %s failed", upper)
 	}
@@ -237,6 +343,83 @@ func removeDirs(containerName string) error {
 	if err := os.RemoveAll(lower); err != nil {
 		return fmt.Errorf("Remove lower-dir %s failed", worker)
 	}
+	// container directory is removed only when empty
+	os.Remove(path.Dir(upper))
 	log.Infof("volume::removeDirs upper-dir %s work-dir %s lower-dir %s successfully", upper, worker, lower)
 	return nil
 }
+
+/**
+ * names of container workspaces under root dir, image tarballs and metadata are skipped
+ */
+func ListWorkSpaces(paths *Paths) ([]string, error) {
+	entries, err := ioutil.ReadDir(paths.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), fmt.Sprintf("read root dir %s failed", paths.Root), err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// root dir may be shared with other files, a workspace has at least two of its layer directories
+		found := 0
+		for _, dir := range []string{paths.lower(entry.Name()), paths.upper(entry.Name()), paths.worker(entry.Name()), paths.merged(entry.Name())} {
+			if _, err := os.Stat(dir); err == nil {
+				found++
+			}
+		}
+		if found >= 2 {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+/**
+ * remove workspace of a container, safe to call on a partially removed or leaked workspace
+ * mounts under merged-dir are lazily detached first, nothing is removed if any of them is still mounted
+ * so that bind-mounted volumes are never removed
+ */
+func CleanWorkSpace(paths *Paths, containerName string) error {
+	merged := paths.merged(containerName)
+	if !IsRootless() {
+		mounts, err := mountsUnder(merged)
+		if err != nil {
+			return err
+		}
+		// deepest mount first, volumes are mounted on top of overlayfs
+		sort.Sort(sort.Reverse(sort.StringSlice(mounts)))
+		for _, mnt := range mounts {
+			if err := unix.Unmount(mnt, unix.MNT_DETACH); err != nil && err != unix.EINVAL {
+				return meta.NewError(meta.NewErrorCode(meta.ErrUnMount, meta.CONTAINER), fmt.Sprintf("Umount %s failed", mnt), err)
+			}
+		}
+	}
+	if err := os.RemoveAll(merged); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), fmt.Sprintf("Remove mountDir %s failed", merged), err)
+	}
+	return removeDirs(paths, containerName)
+}
+
+/**
+ * mount points at or below dir, mount point is the 5th field of /proc/self/mountinfo
+ */
+func mountsUnder(dir string) ([]string, error) {
+	content, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.CONTAINER), "read /proc/self/mountinfo failed", err)
+	}
+	dir = path.Clean(dir)
+	var mounts []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 4 && (fields[4] == dir || strings.HasPrefix(fields[4], dir+"/")) {
+			mounts = append(mounts, fields[4])
+		}
+	}
+	return mounts, nil
+}
@@ -0,0 +1,225 @@
+package events
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 事件日志
+ * 1.容器、网络、镜像的每次状态变化追加一条 JSON 事件到 <state>/events.log；
+ * 2.多个 mydocker 进程并发写入时由 flock 串行化，每条事件一次 write；
+ * 3.日志超过 maxJournalSize 时轮转为 events.log.1，只保留一份；
+ * 写事件失败只记录告警，不影响触发事件的操作
+ * Usage: ./Mydocker events --since 10m --filter type=container --filter event=die
+ */
+
+const (
+	TypeContainer = "container"
+	TypeNetwork   = "network"
+	TypeImage     = "image"
+)
+
+// 容器事件
+const (
+	ActionCreate  = "create"
+	ActionStart   = "start"
+	ActionDie     = "die"
+	ActionOOM     = "oom"
+	ActionKill    = "kill"
+	ActionStop    = "stop"
+	ActionDestroy = "destroy"
+)
+
+// 网络事件
+const (
+	ActionConnect    = "connect"
+	ActionDisconnect = "disconnect"
+)
+
+// 镜像事件
+const (
+	ActionCommit = "commit"
+	ActionDelete = "delete"
+)
+
+const (
+	journalName    = "events.log"
+	maxJournalSize = 10 * 1024 * 1024
+)
+
+/**
+ * 事件，格式与 docker events 一致
+ */
+type Event struct {
+	Type     string `json:"type"`     //container、network、image
+	Action   string `json:"action"`   //事件类型，例如 start、die
+	Actor    Actor  `json:"actor"`    //事件对象
+	Time     int64  `json:"time"`     //unix 时间戳，秒
+	TimeNano int64  `json:"timeNano"` //unix 时间戳，纳秒
+}
+
+/**
+ * 事件对象：容器 Id、网络名或镜像名，以及名称、镜像、退出码、标签等属性
+ */
+type Actor struct {
+	ID         string            `json:"id"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+/**
+ * state 目录下的事件日志
+ */
+type Journal struct {
+	path string
+}
+
+func NewJournal(stateDir string) *Journal {
+	return &Journal{path: path.Join(stateDir, journalName)}
+}
+
+/**
+ * 追加一条事件
+ */
+func (j *Journal) Log(typ, action, id string, attributes map[string]string) {
+	now := time.Now()
+	event := &Event{
+		Type:     typ,
+		Action:   action,
+		Actor:    Actor{ID: id, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+	if err := j.appendEvent(event); err != nil {
+		log.Warnf("record %s %s event of %s failed %v", typ, action, id, err)
+	}
+}
+
+/**
+ * 容器事件，属性包括容器标签、容器名、镜像
+ * 标签先写入，与 name、image、pod 等同名的标签不能覆盖它们
+ */
+func (j *Journal) LogContainer(action string, info *container.Info, extra map[string]string) {
+	attributes := map[string]string{}
+	for k, v := range info.Labels {
+		attributes[k] = v
+	}
+	attributes["name"] = info.Name
+	if info.Image != "" {
+		attributes["image"] = info.Image
+	}
+	if info.Pod != "" {
+		attributes["pod"] = info.Pod
+	}
+	for k, v := range extra {
+		attributes[k] = v
+	}
+	j.Log(TypeContainer, action, info.Id, attributes)
+}
+
+/**
+ * 网络事件，属性包括网络名和连接的容器
+ */
+func (j *Journal) LogNetwork(action, networkName string, info *container.Info) {
+	attributes := map[string]string{"name": networkName}
+	if info != nil {
+		attributes["container"] = info.Id
+		attributes["containerName"] = info.Name
+	}
+	j.Log(TypeNetwork, action, networkName, attributes)
+}
+
+func (j *Journal) appendEvent(event *Event) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.EVENTS), "marshal event failed", err)
+	}
+	if err := os.MkdirAll(path.Dir(j.path), container.Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.EVENTS), fmt.Sprintf("mkdir %s failed", path.Dir(j.path)), err)
+	}
+	file, err := j.openLocked()
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+	if fi, err := file.Stat(); err == nil && fi.Size()+int64(len(content)) > maxJournalSize {
+		// 轮转后写入新文件，其他进程拿到锁后发现文件已被轮转会重新打开
+		if err := os.Rename(j.path, j.path+".1"); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.EVENTS), fmt.Sprintf("rotate %s failed", j.path), err)
+		}
+		file.Close()
+		if file, err = j.openLocked(); err != nil {
+			return err
+		}
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.EVENTS), fmt.Sprintf("write %s failed", j.path), err)
+	}
+	return nil
+}
+
+/**
+ * 打开事件日志并加锁，拿到锁时文件已被其他进程轮转则重新打开
+ * 关闭文件即释放锁
+ */
+func (j *Journal) openLocked() (*os.File, error) {
+	for {
+		file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, container.Perm0644)
+		if err != nil {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.EVENTS), fmt.Sprintf("open %s failed", j.path), err)
+		}
+		for {
+			err = unix.Flock(int(file.Fd()), unix.LOCK_EX)
+			if err != unix.EINTR {
+				break
+			}
+		}
+		if err != nil {
+			file.Close()
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.EVENTS), fmt.Sprintf("lock %s failed", j.path), err)
+		}
+		if !j.isRotated(file) {
+			return file, nil
+		}
+		file.Close()
+	}
+}
+
+/**
+ * 打开的文件已不是当前事件日志
+ */
+func (j *Journal) isRotated(file *os.File) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(j.path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(opened, current)
+}
+
+/**
+ * 文本格式：2006-01-02T15:04:05.000000000Z07:00 container start 1a2b3c (image=busybox, name=web)
+ */
+func (e *Event) String() string {
+	var attrs []string
+	for _, k := range sortedKeys(e.Actor.Attributes) {
+		attrs = append(attrs, k+"="+e.Actor.Attributes[k])
+	}
+	text := fmt.Sprintf("%s %s %s %s", time.Unix(0, e.TimeNano).Format(time.RFC3339Nano), e.Type, e.Action, e.Actor.ID)
+	if len(attrs) > 0 {
+		text += " (" + strings.Join(attrs, ", ") + ")"
+	}
+	return text
+}
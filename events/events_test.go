@@ -0,0 +1,98 @@
+package events
+
+import (
+	"Mydockker/container"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadReplay(t *testing.T) {
+	j := NewJournal(t.TempDir())
+	web := &container.Info{Id: "0123456789", Name: "web", Image: "busybox", Labels: map[string]string{"team": "infra"}}
+	db := &container.Info{Id: "abcdefghij", Name: "db", Image: "redis"}
+	j.LogContainer(ActionCreate, web, nil)
+	j.LogContainer(ActionStart, web, nil)
+	j.LogNetwork(ActionConnect, "testnet", web)
+	j.LogContainer(ActionStart, db, nil)
+	j.LogContainer(ActionDie, web, map[string]string{"exitCode": "137"})
+
+	read := func(filters Filters) []string {
+		var got []string
+		err := j.Read(time.Time{}, time.Now(), filters, func(e *Event) error {
+			got = append(got, e.Type+" "+e.Action+" "+e.Actor.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := read(Filters{}); len(got) != 5 {
+		t.Fatalf("expected all events, got %v", got)
+	}
+	filters, err := ParseFilters([]string{"container=web", "event=start", "event=connect"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := read(filters)
+	if len(got) != 2 || got[0] != "container start 0123456789" || got[1] != "network connect testnet" {
+		t.Fatalf("unexpected filtered events %v", got)
+	}
+	filters, _ = ParseFilters([]string{"label=team=infra", "type=container"})
+	if got := read(filters); len(got) != 3 {
+		t.Fatalf("unexpected label filtered events %v", got)
+	}
+	if _, err := ParseFilters([]string{"status=running"}); err == nil {
+		t.Fatal("expected invalid filter key")
+	}
+}
+
+func TestLogContainerLabelsKeepName(t *testing.T) {
+	j := NewJournal(t.TempDir())
+	web := &container.Info{Id: "0123456789", Name: "web", Image: "busybox", Labels: map[string]string{"name": "spoofed", "image": "spoofed", "team": "infra"}}
+	j.LogContainer(ActionDie, web, map[string]string{"exitCode": "0"})
+	var got []*Event
+	if err := j.Read(time.Time{}, time.Now(), Filters{}, func(e *Event) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected one event, got %d", len(got))
+	}
+	attributes := got[0].Actor.Attributes
+	if attributes["name"] != "web" || attributes["image"] != "busybox" || attributes["team"] != "infra" || attributes["exitCode"] != "0" {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+}
+
+func TestReadRotated(t *testing.T) {
+	j := NewJournal(t.TempDir())
+	info := &container.Info{Id: "0123456789", Name: "web"}
+	j.LogContainer(ActionStart, info, nil)
+	if err := os.Rename(j.path, j.path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	j.LogContainer(ActionDie, info, nil)
+	var actions []string
+	err := j.Read(time.Time{}, time.Now(), Filters{}, func(e *Event) error {
+		actions = append(actions, e.Action)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0] != ActionStart || actions[1] != ActionDie {
+		t.Fatalf("unexpected events %v", actions)
+	}
+}
+
+func TestEventString(t *testing.T) {
+	e := &Event{Type: TypeContainer, Action: ActionDie, Actor: Actor{ID: "0123456789", Attributes: map[string]string{"name": "web", "exitCode": "0"}}, TimeNano: 0}
+	want := time.Unix(0, 0).Format(time.RFC3339Nano) + " container die 0123456789 (exitCode=0, name=web)"
+	if got := e.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 跟踪事件日志的轮询间隔
+const pollInterval = 200 * time.Millisecond
+
+// 支持的过滤条件
+const (
+	filterType      = "type"
+	filterEvent     = "event"
+	filterContainer = "container"
+	filterImage     = "image"
+	filterNetwork   = "network"
+	filterLabel     = "label"
+)
+
+/**
+ * 事件过滤条件，同一个 key 的多个值满足其一即可，不同 key 需同时满足
+ */
+type Filters map[string][]string
+
+/**
+ * 解析 --filter key=value
+ */
+func ParseFilters(filters []string) (Filters, error) {
+	result := Filters{}
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.EVENTS), fmt.Sprintf("invalid filter %s, should be key=value", filter), nil)
+		}
+		switch kv[0] {
+		case filterType, filterEvent, filterContainer, filterImage, filterNetwork, filterLabel:
+		default:
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.EVENTS), fmt.Sprintf("invalid filter key %s, should be one of type, event, container, image, network, label", kv[0]), nil)
+		}
+		result[kv[0]] = append(result[kv[0]], kv[1])
+	}
+	return result, nil
+}
+
+func (f Filters) Match(e *Event) bool {
+	for key, values := range f {
+		matched := false
+		for _, value := range values {
+			if matchFilter(e, key, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * container 匹配容器 Id（或前缀）、容器名，也匹配该容器的网络事件
+ * network 匹配网络名，image 匹配容器镜像和镜像事件
+ */
+func matchFilter(e *Event, key, value string) bool {
+	attrs := e.Actor.Attributes
+	switch key {
+	case filterType:
+		return e.Type == value
+	case filterEvent:
+		return e.Action == value
+	case filterContainer:
+		if e.Type == TypeContainer {
+			return strings.HasPrefix(e.Actor.ID, value) || attrs["name"] == value
+		}
+		return e.Type == TypeNetwork && attrs["container"] != "" && (strings.HasPrefix(attrs["container"], value) || attrs["containerName"] == value)
+	case filterImage:
+		return (e.Type == TypeContainer && attrs["image"] == value) || (e.Type == TypeImage && e.Actor.ID == value)
+	case filterNetwork:
+		return e.Type == TypeNetwork && e.Actor.ID == value
+	case filterLabel:
+		return container.MatchLabel(attrs, value)
+	}
+	return false
+}
+
+/**
+ * 回放 [since, until] 之间的事件后继续跟踪新事件，直到 until，until 为零值时一直跟踪
+ * 1.先读取轮转的 events.log.1，再读取 events.log；
+ * 2.跟踪时 events.log 被轮转，读完旧文件后切换到新文件；
+ */
+func (j *Journal) Read(since, until time.Time, filters Filters, fn func(*Event) error) error {
+	emit := func(line string) (bool, error) {
+		event := new(Event)
+		if err := json.Unmarshal([]byte(line), event); err != nil {
+			return false, nil
+		}
+		eventTime := time.Unix(0, event.TimeNano)
+		if !until.IsZero() && eventTime.After(until) {
+			return true, nil
+		}
+		if eventTime.Before(since) || !filters.Match(event) {
+			return false, nil
+		}
+		return false, fn(event)
+	}
+	if rotated, err := os.Open(j.path + ".1"); err == nil {
+		done, err := readLines(rotated, emit)
+		rotated.Close()
+		if err != nil || done {
+			return err
+		}
+	}
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for {
+		if file == nil {
+			var err error
+			if file, err = os.Open(j.path); err != nil && !os.IsNotExist(err) {
+				return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.EVENTS), fmt.Sprintf("open %s failed", j.path), err)
+			}
+		}
+		if file != nil {
+			done, err := readLines(file, emit)
+			if err != nil || done {
+				return err
+			}
+			// 轮转前写入旧文件的事件已读完，切换到新文件
+			if j.isRotated(file) {
+				file.Close()
+				file = nil
+				continue
+			}
+		}
+		if !until.IsZero() && time.Now().After(until) {
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+/**
+ * 读取文件中已写完的行，不完整的行回退到行首等待下次读取
+ */
+func readLines(file *os.File, emit func(line string) (bool, error)) (bool, error) {
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				if _, serr := file.Seek(-int64(len(line)), io.SeekCurrent); serr != nil {
+					return false, serr
+				}
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.EVENTS), fmt.Sprintf("read %s failed", file.Name()), err)
+		}
+		if done, err := emit(line); err != nil || done {
+			return done, err
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"Mydockker/container"
-	"Mydockker/meta"
 	_ "Mydockker/nsenter"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -23,13 +21,18 @@ const (
 /**
  * exec EnterContainer function
  */
-func EnterContainer(containerName string, comArray []string) {
+func EnterContainer(containerRef string, comArray []string) {
 	// check by environment
-	pid, err := getContainerPidByName(containerName)
+	info, err := resolveContainer(containerRef)
 	if err != nil {
-		log.Errorf("ExecContainer getContainerPidByName failed %v", err)
+		log.Errorf("ExecContainer resolve container %s failed %v", containerRef, err)
 		return
 	}
+	if info.Status != container.RUNNING {
+		log.Errorf("ExecContainer container %s is not running", info.Name)
+		return
+	}
+	containerName, pid := info.Name, info.Pid
 	cmd := exec.Command("/proc/self/exe", "exec")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -47,24 +50,6 @@ func EnterContainer(containerName string, comArray []string) {
 	}
 }
 
-/**
- * get containerPid By containterName
- */
-func getContainerPidByName(containerName string) (string, error) {
-	// get containerInfo by containerName
-	dirUrl := fmt.Sprintf(container.JsonFormat, containerName)
-	configFilePath := dirUrl + container.ConfigName
-	content, err := ioutil.ReadFile(configFilePath)
-	if err != nil {
-		return "", meta.NewError(meta.ErrRead, "read containerInfo failed", err)
-	}
-	var info container.Info
-	if err := json.Unmarshal(content, &info); err != nil {
-		return "", meta.NewError(meta.ErrConvert, "convert to ContainerInfo failed", err)
-	}
-	return info.Pid, nil
-}
-
 /**
  * get environments by pid
  */
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"Mydockker/network"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// object types of inspect, searched in this order when type is not specified
+const (
+	inspectTypeContainer = "container"
+	inspectTypeImage     = "image"
+	inspectTypeNetwork   = "network"
+	inspectTypeVolume    = "volume"
+)
+
+var inspectTypes = []string{inspectTypeContainer, inspectTypeImage, inspectTypeNetwork, inspectTypeVolume}
+
+/**
+ * image information, image is a tar file under root dir
+ */
+type imageInspect struct {
+	Name       string            `json:"name"`
+	Path       string            `json:"path"`
+	Size       int64             `json:"size"`
+	Created    string            `json:"created"`
+	Labels     map[string]string `json:"labels"`
+	Containers []string          `json:"containers"`
+}
+
+/**
+ * network information with endpoints of connected containers
+ */
+type networkInspect struct {
+	Name       string                               `json:"name"`
+	Driver     string                               `json:"driver"`
+	Subnet     string                               `json:"subnet"`
+	Gateway    string                               `json:"gateway"`
+	Labels     map[string]string                    `json:"labels"`
+	Containers map[string]container.NetworkSettings `json:"containers"`
+}
+
+/**
+ * volume information, volume is a host directory bound into containers
+ */
+type volumeInspect struct {
+	Name       string        `json:"name"`
+	Mountpoint string        `json:"mountpoint"`
+	Containers []volumeUsage `json:"containers"`
+}
+
+type volumeUsage struct {
+	Container   string `json:"container"`
+	Destination string `json:"destination"`
+}
+
+/**
+ * print recorded state of container/image/network/volume
+ * 1.objType is empty: search container、image、network、volume in order；
+ * 2.format is empty: print json, otherwise execute go template on the object；
+ * Usage: ./Mydocker inspect --format '{{.NetworkSettings.IPAddress}}' containerName
+ */
+func Inspect(name, objType, format string) error {
+	obj, err := lookupInspectObject(name, objType)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		content, err := json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return meta.NewError(meta.ErrConvert, fmt.Sprintf("marshal %s failed", name), err)
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	tmpl, err := template.New("inspect").Funcs(inspectFuncs).Parse(format)
+	if err != nil {
+		return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("parse format %s failed", format), err)
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, obj); err != nil {
+		return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("execute format %s failed", format), err)
+	}
+	fmt.Println(builder.String())
+	return nil
+}
+
+// functions available in --format templates
+var inspectFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func lookupInspectObject(name, objType string) (interface{}, error) {
+	types := inspectTypes
+	if objType != "" {
+		types = []string{objType}
+	}
+	for _, t := range types {
+		var obj interface{}
+		var err error
+		switch t {
+		case inspectTypeContainer:
+			obj, err = resolveContainer(name)
+		case inspectTypeImage:
+			obj, err = inspectImage(name)
+		case inspectTypeNetwork:
+			obj, err = inspectNetwork(name)
+		case inspectTypeVolume:
+			obj, err = inspectVolume(name)
+		default:
+			return nil, fmt.Errorf("unknown inspect type %s, should be one of %v", t, inspectTypes)
+		}
+		if err == nil {
+			return obj, nil
+		}
+		if objType != "" {
+			return nil, err
+		}
+	}
+	return nil, meta.NewError(meta.ErrNotFound, fmt.Sprintf("no such object: %s", name), nil)
+}
+
+func inspectImage(imageName string) (*imageInspect, error) {
+	imagePath := containerPaths().ImagePath(imageName)
+	fi, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	image := &imageInspect{
+		Name:       imageName,
+		Path:       imagePath,
+		Size:       fi.Size(),
+		Created:    fi.ModTime().Format(time.RFC3339),
+		Containers: []string{},
+	}
+	// images committed by mydocker have metadata
+	if imageMeta, err := container.LoadImageMeta(containerPaths(), imageName); err != nil {
+		return nil, err
+	} else if imageMeta != nil {
+		image.Created = imageMeta.Created
+		image.Labels = imageMeta.Labels
+	}
+	for _, info := range loadContainerInfos() {
+		if info.Image == imageName {
+			image.Containers = append(image.Containers, info.Name)
+		}
+	}
+	return image, nil
+}
+
+func inspectNetwork(networkName string) (*networkInspect, error) {
+	if err := initNetwork(); err != nil {
+		return nil, err
+	}
+	nw, err := network.GetNetwork(networkName)
+	if err != nil {
+		return nil, err
+	}
+	result := &networkInspect{
+		Name:       nw.Name,
+		Driver:     nw.Driver,
+		Labels:     nw.Labels,
+		Containers: map[string]container.NetworkSettings{},
+	}
+	if nw.IPRange != nil {
+		result.Subnet = nw.IPRange.String()
+		result.Gateway = nw.IPRange.IP.String()
+	}
+	for _, info := range loadContainerInfos() {
+		if info.NetworkSettings.Network == networkName {
+			result.Containers[info.Name] = info.NetworkSettings
+		}
+	}
+	return result, nil
+}
+
+func inspectVolume(volumeName string) (*volumeInspect, error) {
+	source := filepath.Clean(volumeName)
+	volume := &volumeInspect{
+		Name:       volumeName,
+		Mountpoint: source,
+	}
+	for _, info := range loadContainerInfos() {
+		for _, m := range info.Mounts {
+			if m.Type == "bind" && filepath.Clean(m.Source) == source {
+				volume.Containers = append(volume.Containers, volumeUsage{Container: info.Name, Destination: m.Destination})
+			}
+		}
+	}
+	if len(volume.Containers) == 0 {
+		return nil, fmt.Errorf("volume %s is not used by any container", volumeName)
+	}
+	return volume, nil
+}
@@ -2,47 +2,144 @@ package main
 
 import (
 	"Mydockker/container"
+	"Mydockker/meta"
+	"Mydockker/state"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"text/template"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// output format of ps
+const (
+	psFormatTable = "table"
+	psFormatJson  = "json"
+)
+
+// command longer than this is truncated unless --no-trunc
+const psCommandWidth = 20
+
+const timeLayout = container.TimeLayout
+
 /**
- * read information of running containerProcess
+ * ps options
+ * 1.all: list stopped containers, only running containers are listed by default；
+ * 2.quiet: only print container ids；
+ * 3.filters: key=value, same keys are ORed and different keys are ANDed；
+ * 4.format: table、json or go template；
  */
-func ListContainers() {
-	files, err := ioutil.ReadDir(container.JsonLocation)
-	if err != nil {
-		log.Errorf("read containerInfo %s failed %v", container.InfoLocation, err)
-		return
+type psOptions struct {
+	all     bool
+	quiet   bool
+	filters map[string][]string
+	format  string
+	noTrunc bool
+}
+
+/**
+ * one row of ps output, also the object of json and template format
+ */
+type psRow struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	Command string            `json:"command"`
+	Created string            `json:"created"`
+	State   string            `json:"state"`
+	Status  string            `json:"status"`
+	Ports   string            `json:"ports"`
+	Pid     string            `json:"pid"`
+	Network string            `json:"network"`
+	Labels  map[string]string `json:"labels"`
+}
+
+/**
+ * parse --filter of network list and pod ps, only label=key[=value] is supported
+ */
+func parseLabelFilters(filters []string) ([]string, error) {
+	var labelFilters []string
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || kv[0] != container.FilterLabel || kv[1] == "" {
+			return nil, fmt.Errorf("invalid filter %s, only label=key[=value] is supported", filter)
+		}
+		labelFilters = append(labelFilters, kv[1])
 	}
-	containers := make([]*container.Info, 0, len(files))
-	for _, file := range files {
-		tmpInfo, err := getContainerInfo(file)
-		if err != nil {
-			log.Errorf("read containerInfo %v failed", file.Name())
+	return labelFilters, nil
+}
+
+/**
+ * list containers
+ */
+func ListContainers(opts *psOptions) error {
+	var tmpl *template.Template
+	if opts.format != "" && opts.format != psFormatTable && opts.format != psFormatJson {
+		var err error
+		if tmpl, err = template.New("ps").Funcs(inspectFuncs).Parse(opts.format); err != nil {
+			return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("parse format %s failed", opts.format), err)
+		}
+	}
+	var rows []*psRow
+	for _, info := range loadContainerInfos() {
+		if !opts.all && info.Status != container.RUNNING {
 			continue
 		}
-		containers = append(containers, tmpInfo)
+		if !container.MatchPsFilters(info, opts.filters) {
+			continue
+		}
+		rows = append(rows, newPsRow(info, opts.noTrunc))
+	}
+	switch {
+	case opts.quiet:
+		for _, row := range rows {
+			fmt.Println(row.ID)
+		}
+	case opts.format == psFormatJson:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return meta.NewError(meta.ErrConvert, fmt.Sprintf("marshal container %s failed", row.Name), err)
+			}
+		}
+	case tmpl != nil:
+		for _, row := range rows {
+			var builder strings.Builder
+			if err := tmpl.Execute(&builder, row); err != nil {
+				return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("execute format %s failed", opts.format), err)
+			}
+			fmt.Println(builder.String())
+		}
+	default:
+		printPsTable(rows)
 	}
-	// print containerInfos into console
+	return nil
+}
+
+/**
+ * print containerInfos into console
+ */
+func printPsTable(rows []*psRow) {
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	_, err = fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\n")
+	_, err := fmt.Fprint(w, "ID\tNAME\tIMAGE\tPID\tCOMMAND\tCREATED\tSTATUS\tPORTS\n")
 	if err != nil {
 		log.Errorf("Fprint error %v", err)
 	}
-	for _, item := range containers {
-		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			item.Id,
-			item.Name,
-			item.Pid,
-			item.Status,
-			item.Command,
-			item.CreateTime)
+	for _, row := range rows {
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.ID,
+			row.Name,
+			row.Image,
+			row.Pid,
+			row.Command,
+			row.Created,
+			row.Status,
+			row.Ports)
 		if err != nil {
 			log.Errorf("Fprint error %v", err)
 		}
@@ -52,23 +149,46 @@ func ListContainers() {
 	}
 }
 
+func newPsRow(info *container.Info, noTrunc bool) *psRow {
+	command := info.Command
+	if !noTrunc && len(command) > psCommandWidth {
+		command = command[:psCommandWidth-3] + "..."
+	}
+	var ports []string
+	for _, pm := range info.PortMapping {
+		if mappings := strings.Split(pm, ":"); len(mappings) == 2 {
+			ports = append(ports, fmt.Sprintf("%s->%s/tcp", mappings[0], mappings[1]))
+		}
+	}
+	return &psRow{
+		ID:      info.Id,
+		Name:    info.Name,
+		Image:   info.Image,
+		Command: command,
+		Created: info.CreateTime,
+		State:   info.Status,
+		Status:  container.HumanStatus(info, time.Now()),
+		Ports:   strings.Join(ports, ", "),
+		Pid:     strings.TrimSpace(info.Pid),
+		Network: info.NetworkSettings.Network,
+		Labels:  info.Labels,
+	}
+}
+
 /**
- * read container information
+ * state store of containers
  */
-func getContainerInfo(file os.FileInfo) (*container.Info, error) {
-	// concat containerFile with containerName
-	containerName := file.Name()
-	configFileDir := fmt.Sprintf(container.JsonFormat, containerName)
-	configFileDir = configFileDir + container.ConfigName
-	content, err := ioutil.ReadFile(configFileDir)
+func containerStore() state.Store {
+	return state.NewFileStore(containerPaths().StateRoot())
+}
+
+/**
+ * read information of all recorded containers
+ */
+func loadContainerInfos() []*container.Info {
+	containers, err := containerStore().List()
 	if err != nil {
-		log.Errorf("read containerFile %s failed %v", configFileDir, err)
-		return nil, err
-	}
-	info := new(container.Info)
-	if err := json.Unmarshal(content, info); err != nil {
-		log.Errorf("json unmarshal failed %v", err)
-		return nil, err
+		log.Errorf("read containerInfo %s failed %v", containerPaths().StateRoot(), err)
 	}
-	return info, nil
+	return containers
 }
@@ -2,31 +2,43 @@ package main
 
 import (
 	"Mydockker/container"
+	"Mydockker/logger"
+	"Mydockker/meta"
 	"fmt"
-	"io/ioutil"
 	"os"
-
-	log "github.com/sirupsen/logrus"
+	"strconv"
+	"syscall"
 )
 
 /**
  * read container's log
+ * follow mode keeps reading until container exits
  */
-func LogContainer(containerName string) {
-	logFileLocation := fmt.Sprintf(container.InfoLogFormat, containerName) + container.LogFileName
-	file, err := os.Open(logFileLocation)
+func LogContainer(containerRef string, opts *logger.ReadOptions) error {
+	info, err := resolveContainer(containerRef)
 	if err != nil {
-		log.Errorf("Open log container file %s failed %v", logFileLocation, err)
-		return
+		return err
 	}
-	content, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Errorf("Read log container file %s failed %v", logFileLocation, err)
-		return
+	if !logger.SupportsRead(info.LogConfig.Type) {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("configured logging driver %s of container %s does not support reading", info.LogConfig.Type, info.Name), nil)
+	}
+	logFileLocation := containerPaths().LogFile(info.Name)
+	return logger.Read(logFileLocation, os.Stdout, os.Stderr, opts, func() bool {
+		return isContainerRunning(info.Name)
+	})
+}
+
+/**
+ * container is running when recorded status is running and its process exists
+ */
+func isContainerRunning(containerName string) bool {
+	info, err := getContainerInfoByName(containerName)
+	if err != nil || info.Status != container.RUNNING {
+		return false
 	}
-	_, err = fmt.Fprint(os.Stdout, string(content))
+	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
-		log.Errorf("Log container Fprint failed %v", err)
-		return
+		return false
 	}
+	return syscall.Kill(pid, 0) == nil
 }
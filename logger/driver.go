@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/**
+ * 日志驱动
+ * 1.json-file：默认驱动，写入本地日志文件，支持 max-size、max-file、compress 轮转，logs 命令可读取；
+ * 2.syslog：按 RFC5424 格式发送到 syslog，地址、tag、facility 由 --log-opt 指定，不保留本地日志；
+ * 3.none：丢弃所有输出；
+ * Usage: ./Mydocker run -d --log-driver none busybox top
+ */
+
+const (
+	DriverJSONFile = "json-file"
+	DriverSyslog   = "syslog"
+	DriverNone     = "none"
+)
+
+/**
+ * 日志驱动接口，Log 由 Writer 串行调用
+ */
+type Driver interface {
+	Name() string
+	Log(entry *Entry) error
+	Close() error
+}
+
+/**
+ * 创建日志驱动所需的容器信息
+ */
+type DriverInfo struct {
+	ContainerID   string
+	ContainerName string
+	LogPath       string            //json-file 日志文件路径
+	Config        map[string]string //--log-opt
+}
+
+type driverSpec struct {
+	new      func(info *DriverInfo) (Driver, error)
+	validate func(opts map[string]string) error
+	readable bool //是否保留本地日志，logs 命令能否读取
+}
+
+var drivers = map[string]driverSpec{
+	DriverJSONFile: {new: newJSONFileDriver, validate: validateJSONFileOpts, readable: true},
+	DriverSyslog:   {new: newSyslogDriver, validate: validateSyslogOpts},
+	DriverNone:     {new: newNoneDriver, validate: validateNoneOpts},
+}
+
+func getDriverSpec(name string) (driverSpec, error) {
+	if name == "" {
+		name = DriverJSONFile
+	}
+	spec, ok := drivers[name]
+	if !ok {
+		names := make([]string, 0, len(drivers))
+		for n := range drivers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return driverSpec{}, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("unknown log driver %s, should be one of %v", name, names), nil)
+	}
+	return spec, nil
+}
+
+/**
+ * 校验日志驱动及其 --log-opt，驱动为空时按 json-file 处理
+ */
+func ValidateLogConfig(name string, opts map[string]string) error {
+	spec, err := getDriverSpec(name)
+	if err != nil {
+		return err
+	}
+	return spec.validate(opts)
+}
+
+/**
+ * 日志驱动是否保留本地日志
+ */
+func SupportsRead(name string) bool {
+	spec, err := getDriverSpec(name)
+	return err == nil && spec.readable
+}
+
+func NewDriver(name string, info *DriverInfo) (Driver, error) {
+	spec, err := getDriverSpec(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.validate(info.Config); err != nil {
+		return nil, err
+	}
+	return spec.new(info)
+}
+
+/**
+ * json-file 驱动，每个条目序列化为一行 json
+ */
+type jsonFileDriver struct {
+	file io.WriteCloser
+}
+
+func newJSONFileDriver(info *DriverInfo) (Driver, error) {
+	cfg, err := parseRotateConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openRotatingFile(info.LogPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonFileDriver{file: file}, nil
+}
+
+func validateJSONFileOpts(opts map[string]string) error {
+	_, err := parseRotateConfig(opts)
+	return err
+}
+
+func (d *jsonFileDriver) Name() string {
+	return DriverJSONFile
+}
+
+func (d *jsonFileDriver) Log(entry *Entry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.LOG), "marshal log entry failed", err)
+	}
+	if _, err := d.file.Write(append(content, '\n')); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), "write log failed", err)
+	}
+	return nil
+}
+
+func (d *jsonFileDriver) Close() error {
+	return d.file.Close()
+}
+
+/**
+ * none 驱动，丢弃所有输出
+ */
+type noneDriver struct{}
+
+func newNoneDriver(info *DriverInfo) (Driver, error) {
+	return noneDriver{}, nil
+}
+
+func validateNoneOpts(opts map[string]string) error {
+	for key := range opts {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("unknown log option %s for log driver %s", key, DriverNone), nil)
+	}
+	return nil
+}
+
+func (noneDriver) Name() string {
+	return DriverNone
+}
+
+func (noneDriver) Log(entry *Entry) error {
+	return nil
+}
+
+func (noneDriver) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"Mydockker/meta"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * 容器日志
+ * 1.detach 容器的 stdout、stderr 分别写入两个管道，读端由 logger 进程（mydocker logger <logPath>）持有，
+ *   stdout 管道为 logger 的 stdin，stderr 管道为 fd 3，容器退出后管道关闭，logger 随之退出；
+ * 2.logger 把每行输出交给 --log-driver 指定的日志驱动，默认 json-file，每行一条：{"log":"...\n","stream":"stdout","time":"<RFC3339Nano>"}；
+ * 3.logs 命令读取 json-file 日志，按时间戳、stream 过滤，支持 --follow、--tail、--since/--until、--timestamps、--stdout/--stderr；
+ * Usage: ./Mydocker run -d --log-driver syslog --log-opt syslog-address=udp://127.0.0.1:514 busybox top
+ *        ./Mydocker logs -f --tail 10 --since 10m --stderr web
+ */
+
+// 输出时间戳格式
+const TimeFormat = time.RFC3339Nano
+
+// 日志驱动写入失败时两次告警的最小间隔
+const dropWarnInterval = 10 * time.Second
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+/**
+ * 日志条目，json-file 中的一行
+ */
+type Entry struct {
+	Line   string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+/**
+ * 串行写入日志条目，stdout、stderr 两个 goroutine 共用
+ */
+type Writer struct {
+	mu     sync.Mutex
+	driver Driver
+	now    func() time.Time
+}
+
+func NewWriter(driver Driver, now func() time.Time) *Writer {
+	return &Writer{driver: driver, now: now}
+}
+
+func (w *Writer) WriteLine(stream, line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.driver.Log(&Entry{Line: line, Stream: stream, Time: w.now().UTC()})
+}
+
+/**
+ * logger 进程：读取容器 stdout、stderr，逐行交给日志驱动
+ */
+func Run(driverName string, info *DriverInfo, stdout, stderr io.Reader) error {
+	driver, err := NewDriver(driverName, info)
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+	w := NewWriter(driver, time.Now)
+	errs := make(chan error, 2)
+	go func() { errs <- Copy(w, stdout, StreamStdout) }()
+	go func() { errs <- Copy(w, stderr, StreamStderr) }()
+	err = <-errs
+	if err2 := <-errs; err == nil {
+		err = err2
+	}
+	return err
+}
+
+/**
+ * 逐行复制一个输出流，最后一行没有换行符时补齐
+ * 日志驱动写入失败时丢弃该条日志并按 dropWarnInterval 限频告警，持续读取直到 EOF，
+ * 避免管道写满阻塞容器，或 logger 退出导致容器收到 SIGPIPE
+ */
+func Copy(w *Writer, src io.Reader, stream string) error {
+	reader := bufio.NewReader(src)
+	dropped := 0
+	var lastWarn time.Time
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			if werr := w.WriteLine(stream, line); werr != nil {
+				dropped++
+				if time.Since(lastWarn) >= dropWarnInterval {
+					log.Warnf("dropped %d %s log entries, last error %v", dropped, stream, werr)
+					dropped = 0
+					lastWarn = time.Now()
+				}
+			}
+		}
+		if err == io.EOF {
+			if dropped > 0 {
+				log.Warnf("dropped %d %s log entries", dropped, stream)
+			}
+			return nil
+		}
+		if err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("read container %s failed", stream), err)
+		}
+	}
+}
+
+func FormatLine(t time.Time, line string) string {
+	return t.UTC().Format(TimeFormat) + " " + line
+}
+
+/**
+ * 解析日志行，兼容旧的 <timestamp> <content> 和无时间戳格式，旧日志 stream 为 stdout
+ */
+func ParseLine(line string) Entry {
+	if strings.HasPrefix(line, "{") {
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err == nil {
+			return entry
+		}
+	}
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if t, err := time.Parse(TimeFormat, line[:i]); err == nil {
+			return Entry{Time: t, Line: line[i+1:], Stream: StreamStdout}
+		}
+	}
+	return Entry{Line: line, Stream: StreamStdout}
+}
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyAndRead(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tick := 0
+	now := func() time.Time {
+		tick++
+		return base.Add(time.Duration(tick) * time.Minute)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&jsonFileDriver{file: nopWriteCloser{&buf}}, now)
+	if err := Copy(w, strings.NewReader("one\ntwo\n"), StreamStdout); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy(w, strings.NewReader("oops"), StreamStderr); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy(w, strings.NewReader("four\n"), StreamStdout); err != nil {
+		t.Fatal(err)
+	}
+	entry := ParseLine(strings.SplitAfter(buf.String(), "\n")[2])
+	if !entry.Time.Equal(base.Add(3*time.Minute)) || entry.Line != "oops\n" || entry.Stream != StreamStderr {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+	logPath := filepath.Join(t.TempDir(), "container.log")
+	if err := ioutil.WriteFile(logPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		opts           ReadOptions
+		stdout, stderr string
+	}{
+		{ReadOptions{Tail: -1}, "one\ntwo\nfour\n", "oops\n"},
+		{ReadOptions{Tail: 2}, "four\n", "oops\n"},
+		{ReadOptions{Tail: 0}, "", ""},
+		{ReadOptions{Tail: 10, Stdout: true}, "one\ntwo\nfour\n", ""},
+		{ReadOptions{Tail: -1, Stderr: true}, "", "oops\n"},
+		{ReadOptions{Tail: -1, Since: base.Add(2 * time.Minute), Until: base.Add(3 * time.Minute)}, "two\n", "oops\n"},
+		{ReadOptions{Tail: 1, Timestamps: true}, "2024-01-01T00:04:00Z four\n", ""},
+	}
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		if err := Read(logPath, &stdout, &stderr, &c.opts, func() bool { return false }); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.String() != c.stdout || stderr.String() != c.stderr {
+			t.Fatalf("options %+v: expected %q %q, got %q %q", c.opts, c.stdout, c.stderr, stdout.String(), stderr.String())
+		}
+	}
+	if entry := ParseLine("2024-01-01T00:00:00Z legacy\n"); entry.Line != "legacy\n" || entry.Stream != StreamStdout || !entry.Time.Equal(base) {
+		t.Fatalf("unexpected legacy entry %v", entry)
+	}
+}
+
+type failingDriver struct{ calls int }
+
+func (d *failingDriver) Name() string { return "failing" }
+
+func (d *failingDriver) Log(entry *Entry) error {
+	d.calls++
+	return io.ErrClosedPipe
+}
+
+func (d *failingDriver) Close() error { return nil }
+
+func TestCopyDrainsWhenDriverFails(t *testing.T) {
+	driver := &failingDriver{}
+	input := strings.Repeat(strings.Repeat("x", 1023)+"\n", 128)
+	if err := Copy(NewWriter(driver, time.Now), strings.NewReader(input), StreamStdout); err != nil {
+		t.Fatal(err)
+	}
+	if driver.calls != 128 {
+		t.Fatalf("expected every line to be read, got %d", driver.calls)
+	}
+}
+
+func TestTailOffsetAcrossChunks(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "container.log")
+	line := strings.Repeat("x", tailChunkSize/3) + "\n"
+	if err := ioutil.WriteFile(logPath, []byte(strings.Repeat(line, 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	offset, lines, err := TailOffset(file, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(3 * len(line)); offset != expected || lines != 7 {
+		t.Fatalf("expected offset %d, got %d, %d lines", expected, offset, lines)
+	}
+	if offset, lines, _ = TailOffset(file, 20); offset != 0 || lines != 10 {
+		t.Fatalf("expected whole file, got offset %d, %d lines", offset, lines)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if ts, _ := ParseTime("10m", now); !ts.Equal(now.Add(-10 * time.Minute)) {
+		t.Fatalf("unexpected relative time %v", ts)
+	}
+	if ts, _ := ParseTime("2024-01-01T10:00:00Z", now); !ts.Equal(now.Add(-2 * time.Hour)) {
+		t.Fatalf("unexpected rfc3339 time %v", ts)
+	}
+	if ts, _ := ParseTime("1704110400", now); !ts.Equal(now) {
+		t.Fatalf("unexpected unix time %v", ts)
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Fatal("expected error for invalid time")
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,358 @@
+package logger
+
+import (
+	"Mydockker/meta"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// follow 模式下 inotify 不可用时的轮询间隔，也是检查容器是否退出的间隔
+const pollInterval = 500 * time.Millisecond
+
+// tail 从文件末尾向前读取的块大小
+const tailChunkSize = 4096
+
+/**
+ * 日志读取选项
+ * 1.Tail：只输出最后 N 行，小于 0 时输出全部；
+ * 2.Since、Until：时间窗口，零值表示不限制；
+ * 3.Timestamps：输出时保留时间戳；
+ * 4.Follow：输出完已有日志后持续跟踪，直到容器退出；
+ * 5.Stdout、Stderr：只输出指定 stream，都为 false 时全部输出；
+ */
+type ReadOptions struct {
+	Tail       int
+	Since      time.Time
+	Until      time.Time
+	Timestamps bool
+	Follow     bool
+	Stdout     bool
+	Stderr     bool
+}
+
+/**
+ * 读取日志，按 stream 分别写入 stdout、stderr，follow 模式下 running 返回 false 且日志读完时结束
+ * 1.先读取已轮转的文件，再读取当前文件；
+ * 2.follow 模式下当前文件被轮转时，读完旧文件后切换到新文件，被原地截断时从头读取；
+ */
+func Read(logPath string, stdout, stderr io.Writer, opts *ReadOptions, running func() bool) error {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("open log file %s failed", logPath), err)
+	}
+	defer func() { file.Close() }()
+	// 需要从轮转文件中读取的行数，小于 0 表示全部
+	history := -1
+	if opts.Tail >= 0 {
+		offset, lines, err := TailOffset(file, opts.Tail)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("seek log file %s failed", logPath), err)
+		}
+		history = opts.Tail - lines
+	}
+	if history != 0 {
+		if done, err := readSegments(logPath, history, stdout, stderr, opts); err != nil || done {
+			return err
+		}
+	}
+	var watcher *fileWatcher
+	if opts.Follow {
+		watcher = newFileWatcher(logPath)
+		defer watcher.close()
+	}
+	reader := bufio.NewReader(file)
+	// follow 模式下不完整的行等待写完再输出
+	pending := ""
+	exited, rotated := false, false
+	for {
+		line, err := reader.ReadString('\n')
+		pending += line
+		if err == nil {
+			if done, werr := writeEntry(stdout, stderr, ParseLine(pending), opts); werr != nil || done {
+				return werr
+			}
+			pending = ""
+			continue
+		}
+		if err != io.EOF {
+			return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("read log file %s failed", logPath), err)
+		}
+		if !opts.Follow || exited {
+			break
+		}
+		// 旧文件已读完，切换到轮转后新建的文件
+		if rotated {
+			newFile, err := os.Open(logPath)
+			if err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("open log file %s failed", logPath), err)
+			}
+			file.Close()
+			file = newFile
+			reader = bufio.NewReader(file)
+			rotated = false
+			continue
+		}
+		// 轮转前写入旧文件的日志还需再读一次
+		if isRotated(file, logPath) {
+			rotated = true
+			continue
+		}
+		// max-file=1 时轮转原地截断当前文件，从头读取截断后写入的日志
+		if isTruncated(file) {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("seek log file %s failed", logPath), err)
+			}
+			reader.Reset(file)
+			if pending != "" {
+				if done, werr := writeEntry(stdout, stderr, ParseLine(pending+"\n"), opts); werr != nil || done {
+					return werr
+				}
+				pending = ""
+			}
+			continue
+		}
+		// 容器退出后再读取一次，保证退出前写入的日志都被输出
+		if !running() {
+			exited = true
+			continue
+		}
+		watcher.wait()
+	}
+	if pending != "" {
+		_, err := writeEntry(stdout, stderr, ParseLine(pending+"\n"), opts)
+		return err
+	}
+	return nil
+}
+
+/**
+ * 读取已轮转的文件，lines 小于 0 时全部输出，否则输出最后 lines 行
+ * 轮转文件大小受 max-size 限制，整体读入内存
+ */
+func readSegments(logPath string, lines int, stdout, stderr io.Writer, opts *ReadOptions) (bool, error) {
+	segments := rotatedSegments(logPath)
+	var collected []string
+	for i := len(segments) - 1; i >= 0 && (lines < 0 || len(collected) < lines); i-- {
+		segmentLines, err := readSegment(segments[i])
+		if err != nil {
+			return false, err
+		}
+		collected = append(segmentLines, collected...)
+	}
+	if lines >= 0 && len(collected) > lines {
+		collected = collected[len(collected)-lines:]
+	}
+	for _, line := range collected {
+		if done, err := writeEntry(stdout, stderr, ParseLine(line), opts); err != nil || done {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+func readSegment(segment string) ([]string, error) {
+	reader, err := openSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var lines []string
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadString('\n')
+		if len(line) > 0 {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("read log file %s failed", segment), err)
+		}
+	}
+}
+
+/**
+ * 打开的文件已不是 logPath 指向的文件，说明发生了轮转
+ */
+func isRotated(file *os.File, logPath string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(logPath)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(opened, current)
+}
+
+/**
+ * 文件比已读取的位置短，说明被原地截断，inode 不变 isRotated 无法发现
+ * 读到 EOF 时 bufio 已无缓冲数据，文件偏移即已读取的位置
+ */
+func isTruncated(file *os.File) bool {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Size() < offset
+}
+
+/**
+ * 按时间窗口、stream 输出一行日志，超过 Until 时返回 done
+ */
+func writeEntry(stdout, stderr io.Writer, entry Entry, opts *ReadOptions) (bool, error) {
+	if !entry.Time.IsZero() {
+		if !opts.Until.IsZero() && entry.Time.After(opts.Until) {
+			return true, nil
+		}
+		if !opts.Since.IsZero() && entry.Time.Before(opts.Since) {
+			return false, nil
+		}
+	}
+	w := stdout
+	if entry.Stream == StreamStderr {
+		if opts.Stdout && !opts.Stderr {
+			return false, nil
+		}
+		w = stderr
+	} else if opts.Stderr && !opts.Stdout {
+		return false, nil
+	}
+	line := entry.Line
+	if opts.Timestamps && !entry.Time.IsZero() {
+		line = FormatLine(entry.Time, line)
+	}
+	if _, err := io.WriteString(w, line); err != nil {
+		return false, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), "write log failed", err)
+	}
+	return false, nil
+}
+
+/**
+ * 最后 n 行的起始偏移和实际找到的行数，从文件末尾按块向前查找，不读取整个文件
+ */
+func TailOffset(file *os.File, n int) (int64, int, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, 0, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), "stat log file failed", err)
+	}
+	end := fi.Size()
+	if n == 0 {
+		return end, 0, nil
+	}
+	buf := make([]byte, tailChunkSize)
+	lines := 0
+	for pos := end; pos > 0; {
+		size := int64(tailChunkSize)
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		if _, err := file.ReadAt(buf[:size], pos); err != nil && err != io.EOF {
+			return 0, 0, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), "read log file failed", err)
+		}
+		for i := size - 1; i >= 0; i-- {
+			// 文件末尾的换行符不是新一行的开始
+			if buf[i] != '\n' || pos+i == end-1 {
+				continue
+			}
+			lines++
+			if lines == n {
+				return pos + i + 1, lines, nil
+			}
+		}
+	}
+	// 文件开头到第一个换行符之间也是一行
+	if end > 0 {
+		lines++
+	}
+	return 0, lines, nil
+}
+
+/**
+ * 解析 --since、--until：RFC3339 时间、unix 时间戳或相对当前的时长（如 10m）
+ */
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Time{}, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid time %s, should be RFC3339, unix timestamp or duration like 10m", value), nil)
+}
+
+/**
+ * 日志文件变化通知，inotify 不可用时退化为轮询
+ */
+type fileWatcher struct {
+	fd int
+}
+
+func newFileWatcher(path string) *fileWatcher {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return &fileWatcher{fd: -1}
+	}
+	// 监听所在目录，轮转后新建的日志文件也能收到通知
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(path), unix.IN_MODIFY|unix.IN_CREATE|unix.IN_MOVED_TO); err != nil {
+		unix.Close(fd)
+		return &fileWatcher{fd: -1}
+	}
+	return &fileWatcher{fd: fd}
+}
+
+/**
+ * 等待文件写入，最长等待 pollInterval
+ */
+func (fw *fileWatcher) wait() {
+	if fw.fd < 0 {
+		time.Sleep(pollInterval)
+		return
+	}
+	fds := []unix.PollFd{{Fd: int32(fw.fd), Events: unix.POLLIN}}
+	if n, err := unix.Poll(fds, int(pollInterval/time.Millisecond)); err != nil || n == 0 {
+		return
+	}
+	// 清空事件
+	buf := make([]byte, unix.SizeofInotifyEvent*16+unix.NAME_MAX+1)
+	for {
+		if n, err := unix.Read(fw.fd, buf); n <= 0 || err != nil {
+			return
+		}
+	}
+}
+
+func (fw *fileWatcher) close() {
+	if fw.fd >= 0 {
+		unix.Close(fw.fd)
+	}
+}
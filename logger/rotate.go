@@ -0,0 +1,281 @@
+package logger
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * 日志轮转
+ * 1.--log-opt max-size=10m：当前日志超过 max-size 时轮转，未设置时不轮转；
+ * 2.--log-opt max-file=3：最多保留的日志文件数，包括当前文件，默认 1，即只截断当前文件；
+ * 3.--log-opt compress=true：轮转后的文件用 gzip 压缩；
+ * 轮转由持有容器输出管道的 logger 进程完成，文件依次为 container.log、container.log.1[.gz]、container.log.2[.gz]...，序号越大越旧
+ * Usage: ./Mydocker run -d --log-opt max-size=10m,max-file=3,compress=true busybox top
+ */
+
+const (
+	optMaxSize  = "max-size"
+	optMaxFile  = "max-file"
+	optCompress = "compress"
+)
+
+const gzipSuffix = ".gz"
+
+/**
+ * 日志轮转配置
+ */
+type rotateConfig struct {
+	maxSize  int64
+	maxFile  int
+	compress bool
+}
+
+/**
+ * 解析 --log-opt，每个值可以包含多个逗号分隔的 k=v，选项由日志驱动校验
+ */
+func ParseLogOpts(logOpts []string) (map[string]string, error) {
+	opts := make(map[string]string)
+	for _, logOpt := range logOpts {
+		for _, opt := range strings.Split(logOpt, ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s, should be key=value", opt), nil)
+			}
+			opts[kv[0]] = kv[1]
+		}
+	}
+	return opts, nil
+}
+
+/**
+ * 解析 json-file 驱动的轮转选项
+ */
+func parseRotateConfig(opts map[string]string) (*rotateConfig, error) {
+	cfg := &rotateConfig{maxSize: -1, maxFile: 1}
+	for key, value := range opts {
+		switch key {
+		case optMaxSize:
+			size, err := container.ParseByteSize(value)
+			if err != nil {
+				return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s", key, value), err)
+			}
+			cfg.maxSize = size
+		case optMaxFile:
+			maxFile, err := strconv.Atoi(value)
+			if err != nil || maxFile < 1 {
+				return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s, should be a positive number", key, value), err)
+			}
+			cfg.maxFile = maxFile
+		case optCompress:
+			compress, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s, should be true or false", key, value), err)
+			}
+			cfg.compress = compress
+		default:
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("unknown log option %s", key), nil)
+		}
+	}
+	if cfg.maxSize < 0 && (opts[optMaxFile] != "" || opts[optCompress] != "") {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), "log options max-file and compress require max-size", nil)
+	}
+	return cfg, nil
+}
+
+/**
+ * 支持轮转的日志文件，每次 Write 写入完整的一条日志，不会被拆分到两个文件
+ */
+type rotatingFile struct {
+	path string
+	file *os.File
+	size int64
+	cfg  *rotateConfig
+}
+
+/**
+ * 新建日志文件，清理同名容器遗留的轮转文件
+ */
+func openRotatingFile(path string, cfg *rotateConfig) (*rotatingFile, error) {
+	for _, segment := range rotatedSegments(path) {
+		os.Remove(segment)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, container.Perm0644)
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("open log file %s failed", path), err)
+	}
+	return &rotatingFile{path: path, file: file, cfg: cfg}, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		// 上次轮转后没能重新打开日志文件，再试一次
+		if err := f.reopen(); err != nil {
+			return 0, err
+		}
+	} else if f.cfg.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.cfg.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+/**
+ * 轮转：container.log.i 依次后移，超出 max-file 的最旧文件被删除，当前文件变为 container.log.1
+ * 移动文件失败时截断当前文件，压缩失败时保留未压缩的文件，两者都只告警
+ * 无论轮转是否成功都重新打开当前文件，只有重新打开失败才返回错误
+ */
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		log.Warnf("close log file %s failed %v", f.path, err)
+	}
+	f.file = nil
+	if f.cfg.maxFile > 1 {
+		if err := f.shiftSegments(); err != nil {
+			log.Warnf("%v, truncating %s", err, f.path)
+		}
+	}
+	return f.reopen()
+}
+
+/**
+ * 已轮转的文件依次后移，当前文件移动为 container.log.1 并按需压缩
+ */
+func (f *rotatingFile) shiftSegments() error {
+	last := segmentPath(f.path, f.cfg.maxFile-1)
+	os.Remove(last)
+	os.Remove(last + gzipSuffix)
+	for i := f.cfg.maxFile - 2; i >= 1; i-- {
+		for _, suffix := range []string{"", gzipSuffix} {
+			src := segmentPath(f.path, i) + suffix
+			if _, err := os.Stat(src); err == nil {
+				if err := os.Rename(src, segmentPath(f.path, i+1)+suffix); err != nil {
+					return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("rotate log file %s failed", src), err)
+				}
+			}
+		}
+	}
+	newest := segmentPath(f.path, 1)
+	if err := os.Rename(f.path, newest); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("rotate log file %s failed", f.path), err)
+	}
+	if f.cfg.compress {
+		if err := compressFile(newest); err != nil {
+			log.Warnf("%v, keeping %s uncompressed", err, newest)
+		}
+	}
+	return nil
+}
+
+/**
+ * 截断并重新打开当前日志文件
+ */
+func (f *rotatingFile) reopen() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, container.Perm0644)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("open log file %s failed", f.path), err)
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+/**
+ * gzip 压缩文件，成功后删除原文件
+ */
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("open log file %s failed", path), err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+gzipSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, container.Perm0644)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("create %s failed", path+gzipSuffix), err)
+	}
+	defer func() {
+		dst.Close()
+		// 压缩失败时删除不完整的压缩文件，避免与原文件同时存在
+		if err != nil {
+			os.Remove(path + gzipSuffix)
+		}
+	}()
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("compress log file %s failed", path), err)
+	}
+	if err := gz.Close(); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("compress log file %s failed", path), err)
+	}
+	return os.Remove(path)
+}
+
+func segmentPath(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+/**
+ * 已轮转的日志文件，从旧到新排列
+ */
+func rotatedSegments(path string) []string {
+	var segments []string
+	for i := 1; ; i++ {
+		segment := segmentPath(path, i)
+		if _, err := os.Stat(segment); err != nil {
+			segment += gzipSuffix
+			if _, err := os.Stat(segment); err != nil {
+				break
+			}
+		}
+		segments = append([]string{segment}, segments...)
+	}
+	return segments
+}
+
+/**
+ * 打开轮转文件，压缩文件透明解压
+ */
+func openSegment(segment string) (io.ReadCloser, error) {
+	file, err := os.Open(segment)
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("open log file %s failed", segment), err)
+	}
+	if filepath.Ext(segment) != gzipSuffix {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.LOG), fmt.Sprintf("decompress log file %s failed", segment), err)
+	}
+	return &gzipReadCloser{Reader: gz, file: file}, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotateAndReadSegments(t *testing.T) {
+	opts, err := ParseLogOpts([]string{"max-size=1k,max-file=3", "compress=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := parseRotateConfig(opts)
+	logPath := filepath.Join(t.TempDir(), "container.log")
+	file, err := openRotatingFile(logPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(&jsonFileDriver{file: file}, time.Now)
+	var expected []string
+	for i := 0; i < 60; i++ {
+		line := fmt.Sprintf("line-%02d\n", i)
+		expected = append(expected, line)
+		if err := w.WriteLine(StreamStdout, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Close()
+	segments := rotatedSegments(logPath)
+	if len(segments) != 2 || !strings.HasSuffix(segments[0], ".2.gz") || !strings.HasSuffix(segments[1], ".1.gz") {
+		t.Fatalf("unexpected segments %v", segments)
+	}
+	if _, err := os.Stat(logPath + ".3.gz"); err == nil {
+		t.Fatal("segments beyond max-file should be removed")
+	}
+	var out bytes.Buffer
+	if err := Read(logPath, &out, &out, &ReadOptions{Tail: -1}, func() bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(out.String(), "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) >= 60 || !strings.HasSuffix(out.String(), strings.Join(expected[len(expected)-len(lines):], "")) {
+		t.Fatalf("unexpected logs across segments %q", out.String())
+	}
+	// tail more lines than current file holds
+	out.Reset()
+	tail := len(lines) - 2
+	if err := Read(logPath, &out, &out, &ReadOptions{Tail: tail}, func() bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != strings.Join(expected[len(expected)-tail:], "") {
+		t.Fatalf("unexpected tail across segments %q", out.String())
+	}
+}
+
+func TestRotateKeepsWritingWhenCompressFails(t *testing.T) {
+	cfg := &rotateConfig{maxSize: 64, maxFile: 2, compress: true}
+	logPath := filepath.Join(t.TempDir(), "container.log")
+	file, err := openRotatingFile(logPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// a directory in place of container.log.1.gz makes gzip fail
+	if err := os.MkdirAll(filepath.Join(logPath+".1.gz", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := file.Write([]byte(fmt.Sprintf("line-%02d\n", i))); err != nil {
+			t.Fatalf("write after failed compression: %v", err)
+		}
+	}
+	if _, err := os.Stat(logPath + ".1"); err != nil {
+		t.Fatalf("uncompressed segment should be kept: %v", err)
+	}
+	content, err := os.ReadFile(logPath)
+	if err != nil || !strings.HasSuffix(string(content), "line-19\n") {
+		t.Fatalf("current log file should keep receiving writes, got %q %v", content, err)
+	}
+}
+
+func TestFollowAcrossTruncate(t *testing.T) {
+	// max-file=1 truncates container.log in place, inode is unchanged
+	cfg := &rotateConfig{maxSize: 512, maxFile: 1}
+	logPath := filepath.Join(t.TempDir(), "container.log")
+	file, err := openRotatingFile(logPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := NewWriter(&jsonFileDriver{file: file}, time.Now)
+	var expected []string
+	for i := 0; i < 5; i++ {
+		line := fmt.Sprintf("line-%02d\n", i)
+		expected = append(expected, line)
+		if err := w.WriteLine(StreamStdout, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &syncBuffer{}
+	deadline := time.Now().Add(5 * time.Second)
+	running := func() bool {
+		return time.Now().Before(deadline) && !strings.HasSuffix(out.String(), "after-truncate\n")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- Read(logPath, out, out, &ReadOptions{Tail: -1, Follow: true}, running)
+	}()
+	for out.String() != strings.Join(expected, "") {
+		if time.Now().After(deadline) {
+			t.Fatalf("logs before truncation not followed, got %q", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	before, _ := os.Stat(logPath)
+	// long line exceeds max-size, file is truncated and shorter than offset of reader
+	line := strings.Repeat("x", 200) + " after-truncate\n"
+	if err := w.WriteLine(StreamStdout, line); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(logPath)
+	if !os.SameFile(before, after) || after.Size() >= before.Size() {
+		t.Fatalf("expected container.log truncated in place, size %d -> %d", before.Size(), after.Size())
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != strings.Join(expected, "")+line {
+		t.Fatalf("unexpected logs across truncation %q", out.String())
+	}
+}
+
+// output shared by Read in follow mode and the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestParseLogOpts(t *testing.T) {
+	for _, invalid := range []string{"max-size=abc", "max-file=0", "max-file=2", "compress=yes", "unknown=1", "max-size"} {
+		opts, err := ParseLogOpts([]string{invalid})
+		if err == nil {
+			err = ValidateLogConfig(DriverJSONFile, opts)
+		}
+		if err == nil {
+			t.Fatalf("expected error for %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package logger
+
+import (
+	"Mydockker/meta"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * syslog 驱动
+ * 1.--log-opt syslog-address：unix:///dev/log（默认）、unixgram://、udp://host:port、tcp://host:port；
+ * 2.--log-opt tag：APP-NAME，go template，可用 {{.ID}}、{{.Name}}，默认为容器 ID；
+ * 3.--log-opt syslog-facility：默认 daemon；
+ * 消息为 RFC5424 格式，stdout 的 severity 为 info，stderr 为 err，tcp 使用 octet-counting 分帧（RFC6587）
+ * Usage: ./Mydocker run -d --log-driver syslog --log-opt syslog-address=tcp://127.0.0.1:514,tag={{.Name}} busybox top
+ */
+
+const (
+	optSyslogAddress  = "syslog-address"
+	optSyslogFacility = "syslog-facility"
+	optTag            = "tag"
+)
+
+const defaultSyslogAddress = "unix:///dev/log"
+
+// RFC5424 中 APP-NAME 最长 48 个字符
+const maxAppNameLen = 48
+
+// RFC5424 时间戳，秒的小数部分最多 6 位
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+const (
+	// 连接 syslog 的超时时间
+	syslogDialTimeout = 5 * time.Second
+	// 重连失败后再次重连的间隔
+	syslogRetryInterval = 5 * time.Second
+	// 流式连接的写超时，syslog 服务卡住时不阻塞容器的 stdout 管道
+	syslogWriteTimeout = 2 * time.Second
+)
+
+const (
+	severityErr  = 3
+	severityInfo = 6
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type syslogDriver struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	pid      int
+	conn     net.Conn
+	retryAt  time.Time //重连失败后下次重连的时间
+}
+
+/**
+ * 解析 syslog-address，返回 net.Dial 使用的 network、address
+ */
+func parseSyslogAddress(value string) (string, string, error) {
+	if value == "" {
+		value = defaultSyslogAddress
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s", optSyslogAddress, value), err)
+	}
+	switch u.Scheme {
+	case "unix", "unixgram":
+		if u.Path == "" {
+			break
+		}
+		return u.Scheme, u.Path, nil
+	case "udp", "tcp":
+		if u.Host == "" {
+			break
+		}
+		if u.Port() == "" {
+			return u.Scheme, net.JoinHostPort(u.Hostname(), "514"), nil
+		}
+		return u.Scheme, u.Host, nil
+	}
+	return "", "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s, should be unix://path, unixgram://path, udp://host:port or tcp://host:port", optSyslogAddress, value), nil)
+}
+
+func parseSyslogFacility(value string) (int, error) {
+	if value == "" {
+		return syslogFacilities["daemon"], nil
+	}
+	if facility, ok := syslogFacilities[value]; ok {
+		return facility, nil
+	}
+	if facility, err := strconv.Atoi(value); err == nil && facility >= 0 && facility <= 23 {
+		return facility, nil
+	}
+	return 0, meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s", optSyslogFacility, value), nil)
+}
+
+func validateSyslogOpts(opts map[string]string) error {
+	for key := range opts {
+		switch key {
+		case optSyslogAddress, optSyslogFacility, optTag:
+		default:
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("unknown log option %s for log driver %s", key, DriverSyslog), nil)
+		}
+	}
+	if _, _, err := parseSyslogAddress(opts[optSyslogAddress]); err != nil {
+		return err
+	}
+	if _, err := parseSyslogFacility(opts[optSyslogFacility]); err != nil {
+		return err
+	}
+	if _, err := template.New(optTag).Parse(opts[optTag]); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s", optTag, opts[optTag]), err)
+	}
+	return nil
+}
+
+/**
+ * 渲染 tag，为空时使用容器 ID
+ */
+func renderTag(value string, info *DriverInfo) (string, error) {
+	if value == "" {
+		return info.ContainerID, nil
+	}
+	tmpl, err := template.New(optTag).Parse(value)
+	if err != nil {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("invalid log option %s=%s", optTag, value), err)
+	}
+	var builder strings.Builder
+	data := struct{ ID, Name string }{ID: info.ContainerID, Name: info.ContainerName}
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.LOG), fmt.Sprintf("execute log option %s=%s failed", optTag, value), err)
+	}
+	return builder.String(), nil
+}
+
+func newSyslogDriver(info *DriverInfo) (Driver, error) {
+	network, address, err := parseSyslogAddress(info.Config[optSyslogAddress])
+	if err != nil {
+		return nil, err
+	}
+	facility, err := parseSyslogFacility(info.Config[optSyslogFacility])
+	if err != nil {
+		return nil, err
+	}
+	tag, err := renderTag(info.Config[optTag], info)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	d := &syslogDriver{
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+	// syslog 暂时不可用时不能让 logger 退出，否则容器写 stdout 时收到 SIGPIPE，由 Log 稍后重连
+	if err := d.dial(); err != nil {
+		log.Warnf("%v, retry in %v", err, syslogRetryInterval)
+		d.retryAt = time.Now().Add(syslogRetryInterval)
+	}
+	return d, nil
+}
+
+/**
+ * 连接 syslog，unix 地址先尝试 unixgram（/dev/log 通常是数据报套接字）再尝试 unix
+ */
+func (d *syslogDriver) dial() error {
+	networks := []string{d.network}
+	if d.network == "unix" {
+		networks = []string{"unixgram", "unix"}
+	}
+	var err error
+	for _, network := range networks {
+		var conn net.Conn
+		if conn, err = net.DialTimeout(network, d.address, syslogDialTimeout); err == nil {
+			d.conn = conn
+			d.network = network
+			return nil
+		}
+	}
+	return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("connect syslog %s failed", d.address), err)
+}
+
+func (d *syslogDriver) Name() string {
+	return DriverSyslog
+}
+
+func (d *syslogDriver) Log(entry *Entry) error {
+	msg := formatRFC5424(entry, d.facility, d.hostname, d.tag, d.pid)
+	if d.conn != nil {
+		if err := d.write(msg); err == nil {
+			return nil
+		}
+		d.conn.Close()
+		d.conn = nil
+	}
+	// 连接断开时重连，重连失败后 syslogRetryInterval 内直接丢弃日志
+	if time.Now().Before(d.retryAt) {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("syslog %s unavailable", d.address), nil)
+	}
+	if err := d.dial(); err != nil {
+		d.retryAt = time.Now().Add(syslogRetryInterval)
+		return err
+	}
+	if err := d.write(msg); err != nil {
+		d.conn.Close()
+		d.conn = nil
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.LOG), fmt.Sprintf("write syslog %s failed", d.address), err)
+	}
+	return nil
+}
+
+/**
+ * 按连接类型分帧后写入，流式连接带写超时
+ */
+func (d *syslogDriver) write(msg string) error {
+	if d.network == "tcp" || d.network == "unix" {
+		if err := d.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout)); err != nil {
+			return err
+		}
+	}
+	_, err := d.conn.Write(d.frame(msg))
+	return err
+}
+
+/**
+ * 流式连接需要分帧：tcp 使用 octet-counting，unix 流套接字以换行结尾
+ */
+func (d *syslogDriver) frame(msg string) []byte {
+	switch d.network {
+	case "tcp":
+		return []byte(strconv.Itoa(len(msg)) + " " + msg)
+	case "unix":
+		return []byte(msg + "\n")
+	}
+	return []byte(msg)
+}
+
+func (d *syslogDriver) Close() error {
+	if d.conn == nil {
+		return nil
+	}
+	return d.conn.Close()
+}
+
+/**
+ * RFC5424：<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+ */
+func formatRFC5424(entry *Entry, facility int, hostname, tag string, pid int) string {
+	severity := severityInfo
+	if entry.Stream == StreamStderr {
+		severity = severityErr
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	if tag == "" {
+		tag = "-"
+	}
+	if len(tag) > maxAppNameLen {
+		tag = tag[:maxAppNameLen]
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s", facility*8+severity, entry.Time.UTC().Format(syslogTimeFormat),
+		hostname, tag, pid, strings.TrimSuffix(entry.Line, "\n"))
+}
@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogDriver(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	info := &DriverInfo{
+		ContainerID:   "0123456789",
+		ContainerName: "web",
+		Config: map[string]string{
+			optSyslogAddress:  "tcp://" + listener.Addr().String(),
+			optSyslogFacility: "local0",
+			optTag:            "app/{{.Name}}",
+		},
+	}
+	driver, err := NewDriver(DriverSyslog, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	entry := &Entry{Line: "oops\n", Stream: StreamStderr, Time: time.Date(2024, 1, 1, 0, 0, 0, 1500, time.UTC)}
+	if err := driver.Log(entry); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	// octet-counting: MSG-LEN SP SYSLOG-MSG
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		t.Fatal(err)
+	}
+	// local0(16)*8 + err(3) = 131
+	got := string(msg)
+	if !strings.HasPrefix(got, "<131>1 2024-01-01T00:00:00.000001Z ") || !strings.Contains(got, " app/web ") || !strings.HasSuffix(got, " - - oops") {
+		t.Fatalf("unexpected syslog message %q", got)
+	}
+}
+
+func TestSyslogDriverStartsWithoutServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "syslog.sock")
+	info := &DriverInfo{
+		ContainerID: "0123456789",
+		Config:      map[string]string{optSyslogAddress: "unix://" + socket},
+	}
+	// syslog not listening yet must not stop the logger
+	driver, err := NewDriver(DriverSyslog, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	entry := &Entry{Line: "hello\n", Stream: StreamStdout, Time: time.Now()}
+	if err := driver.Log(entry); err == nil {
+		t.Fatal("expected error before syslog is up")
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	// skip retry interval
+	driver.(*syslogDriver).retryAt = time.Time{}
+	if err := driver.Log(entry); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasSuffix(line, " - - hello\n") {
+		t.Fatalf("unexpected syslog message %q %v", line, err)
+	}
+}
+
+func TestValidateLogConfig(t *testing.T) {
+	valid := []struct {
+		driver string
+		opts   map[string]string
+	}{
+		{"", map[string]string{optMaxSize: "1m"}},
+		{DriverNone, nil},
+		{DriverSyslog, map[string]string{optSyslogAddress: "udp://127.0.0.1", optTag: "{{.ID}}"}},
+	}
+	for _, c := range valid {
+		if err := ValidateLogConfig(c.driver, c.opts); err != nil {
+			t.Fatalf("unexpected error for %s %v: %v", c.driver, c.opts, err)
+		}
+	}
+	invalid := []struct {
+		driver string
+		opts   map[string]string
+	}{
+		{"gelf", nil},
+		{DriverNone, map[string]string{optMaxSize: "1m"}},
+		{DriverSyslog, map[string]string{optMaxSize: "1m"}},
+		{DriverSyslog, map[string]string{optSyslogAddress: "http://127.0.0.1"}},
+		{DriverSyslog, map[string]string{optSyslogFacility: "nope"}},
+		{DriverSyslog, map[string]string{optTag: "{{.ID"}},
+	}
+	for _, c := range invalid {
+		if err := ValidateLogConfig(c.driver, c.opts); err == nil {
+			t.Fatalf("expected error for %s %v", c.driver, c.opts)
+		}
+	}
+	if SupportsRead(DriverSyslog) || SupportsRead(DriverNone) || !SupportsRead("") {
+		t.Fatal("only json-file keeps local logs")
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"Mydockker/config"
+	"Mydockker/container"
+	"Mydockker/events"
+	"Mydockker/network"
 	"os"
 
 	log "github.com/sirupsen/logrus"
@@ -11,28 +15,67 @@ const usage = `mydocker is a simple container runtime implementation.
 			   The purpose of this project is to learn how docker works and how to write a docker by ourselves
 			   Enjoy it, just for fun.`
 
+// commands run by mydocker itself as container init, logger or pod infra process
+var internalCommands = map[string]bool{
+	"init":   true,
+	"logger": true,
+	"pause":  true,
+}
+
+// globalConfig is the config file merged with global flags, resolved before any command runs
+var globalConfig *config.Config
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "Mydocker"
 	app.Usage = usage
 
+	// global flags, override config file
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "root",
+			Usage: "root directory of images and container layers",
+		},
+		cli.StringFlag{
+			Name:  "state",
+			Usage: "state directory of container records, logs, pods and networks",
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "config file, default /etc/mydocker/config.toml or /etc/mydocker/config.json",
+		},
+	}
+
 	// init command params
 	app.Commands = []cli.Command{
 		initCommand,
 		runCommand,
 		commitCommand,
 		listCommand,
+		inspectCommand,
 		logCommand,
 		execCommand,
 		stopCommand,
 		removeCommand,
 		networkCommand,
+		podCommand,
+		pauseCommand,
+		loggerCommand,
+		systemCommand,
+		eventsCommand,
 	}
 
 	// init logrus configs
 	app.Before = func(ctx *cli.Context) error {
 		log.SetFormatter(&log.JSONFormatter{})
 		log.SetOutput(os.Stdout)
+		if err := loadConfig(ctx); err != nil {
+			return err
+		}
+		// helper processes and exec inside container never touch state of other containers, system reconciles itself
+		if command := ctx.Args().First(); !internalCommands[command] && command != "system" && os.Getenv(EnvExecPid) == "" {
+			reconcileContainers()
+		}
 		return nil
 	}
 
@@ -41,6 +84,48 @@ func main() {
 	}
 }
 
+/**
+ * load config file and apply --root/--state, directories are derived from globalConfig afterwards
+ */
+func loadConfig(ctx *cli.Context) error {
+	cfg, err := config.Load(ctx.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+	if root := ctx.GlobalString("root"); root != "" {
+		cfg.Root = root
+	}
+	if state := ctx.GlobalString("state"); state != "" {
+		cfg.State = state
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	globalConfig = cfg
+	return nil
+}
+
+/**
+ * directories of images, workspaces and container state resolved from config
+ */
+func containerPaths() *container.Paths {
+	return container.NewPaths(globalConfig.Root, globalConfig.State)
+}
+
+/**
+ * event journal under state directory
+ */
+func eventJournal() *events.Journal {
+	return events.NewJournal(globalConfig.State)
+}
+
+/**
+ * load networks recorded under network state directory
+ */
+func initNetwork() error {
+	return network.Init(globalConfig.NetworkDir())
+}
+
 // urfaveCli-demo
 func urfaveCli() {
 	app := cli.NewApp()
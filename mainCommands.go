@@ -3,9 +3,14 @@ package main
 import (
 	"Mydockker/cgroups/subsystems"
 	"Mydockker/container"
+	"Mydockker/events"
+	"Mydockker/logger"
 	"Mydockker/network"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -66,12 +71,102 @@ var runCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "net",
-			Usage: "container network",
+			Usage: "container network name, host or container:<name>, only slirp4netns and host in rootless mode",
+		},
+		cli.StringFlag{
+			Name:  "pod",
+			Usage: "run container in an existing pod",
+		},
+		cli.StringFlag{
+			Name:  "pid",
+			Usage: "pid namespace to use, private, host or container:<name|id>",
+		},
+		cli.StringFlag{
+			Name:  "ipc",
+			Usage: "ipc namespace to use, private, host or container:<name|id>",
+		},
+		cli.StringFlag{
+			Name:  "uts",
+			Usage: "uts namespace to use, private, host or container:<name|id>",
 		},
 		cli.StringSliceFlag{
 			Name:  "p",
 			Usage: "port mapping",
 		},
+		cli.StringSliceFlag{
+			Name:  "cap-add",
+			Usage: "add linux capabilities",
+		},
+		cli.StringSliceFlag{
+			Name:  "cap-drop",
+			Usage: "drop linux capabilities",
+		},
+		cli.BoolFlag{
+			Name:  "privileged",
+			Usage: "give all capabilities to this container and disable seccomp",
+		},
+		cli.StringSliceFlag{
+			Name:  "security-opt",
+			Usage: "security options, e.g. seccomp=profile.json or seccomp=unconfined",
+		},
+		cli.BoolFlag{
+			Name:  "read-only",
+			Usage: "mount the container's root filesystem as read only",
+		},
+		cli.StringSliceFlag{
+			Name:  "tmpfs",
+			Usage: "mount a tmpfs directory, e.g. /run:size=64m",
+		},
+		cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container hostname, default to container id",
+		},
+		cli.StringFlag{
+			Name:  "domainname",
+			Usage: "container NIS domain name",
+		},
+		cli.StringSliceFlag{
+			Name:  "ulimit",
+			Usage: "ulimit options, e.g. nofile=65536:65536",
+		},
+		cli.IntFlag{
+			Name:  "oom-score-adj",
+			Usage: "tune container's OOM preferences (-1000 to 1000)",
+		},
+		cli.StringSliceFlag{
+			Name:  "sysctl",
+			Usage: "namespaced kernel parameters, e.g. net.core.somaxconn=1024",
+		},
+		cli.StringFlag{
+			Name:  "cgroupns",
+			Usage: "cgroup namespace to use, host or private",
+			Value: container.CgroupNSPrivate,
+		},
+		cli.StringFlag{
+			Name:  "time-offset",
+			Usage: "run in a new time namespace, e.g. monotonic=86400s,boottime=-1h",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set metadata, e.g. team=infra",
+		},
+		cli.StringSliceFlag{
+			Name:  "label-file",
+			Usage: "read in a line delimited file of labels",
+		},
+		cli.StringFlag{
+			Name:  "log-driver",
+			Usage: "logging driver of detached container: json-file, syslog or none, default log-driver of config file",
+		},
+		cli.StringSliceFlag{
+			Name:  "log-opt",
+			Usage: "log driver options, e.g. max-size=10m,max-file=3,compress=true",
+		},
+		cli.StringFlag{
+			Name:  "shm-size",
+			Usage: "size of /dev/shm, e.g. 64m",
+			Value: container.DefaultShmSize,
+		},
 	},
 	/**
 	 * parse commandline, tty represents allow bash windows
@@ -91,9 +186,18 @@ var runCommand = cli.Command{
 			return fmt.Errorf("can't execute container by tty and detach synchronizly")
 		}
 		containerName := context.String("name")
+		if containerName != "" {
+			// uniqueness is checked when name is reserved in state store
+			if err := container.ValidateContainerName(containerName); err != nil {
+				return err
+			}
+		}
 		envSlice := context.StringSlice("e")
 		volume := context.String("v")
 		network := context.String("net")
+		if !context.IsSet("net") && context.String("pod") == "" {
+			network = globalConfig.DefaultNetwork
+		}
 		portMapping := context.StringSlice("p")
 		imageName := cmdArray[0]
 		cmdArray = cmdArray[1:]
@@ -104,9 +208,129 @@ var runCommand = cli.Command{
 			CpuSet:      context.String("cpuset"),
 		}
 		log.Infof("resConf:%v", resConfig)
+		// resolve capabilities of container init process
+		privileged := context.Bool("privileged")
+		caps, err := container.ResolveCapabilities(context.StringSlice("cap-add"), context.StringSlice("cap-drop"), privileged)
+		if err != nil {
+			return err
+		}
+		// compile seccomp profile with capabilities of container
+		seccompOpt, err := parseSecurityOpts(context.StringSlice("security-opt"), privileged)
+		if err != nil {
+			return err
+		}
+		seccompFilter, err := compileSeccomp(seccompOpt, caps)
+		if err != nil {
+			return err
+		}
+		tmpfs := context.StringSlice("tmpfs")
+		if err := container.ValidateTmpfs(tmpfs); err != nil {
+			return err
+		}
+		shmSize, err := container.ParseByteSize(context.String("shm-size"))
+		if err != nil {
+			return err
+		}
+		rlimits, err := container.ParseUlimits(append(globalConfig.DefaultUlimits, context.StringSlice("ulimit")...))
+		if err != nil {
+			return err
+		}
+		// --net is namespace mode when host or container:<name>, otherwise network name
+		namespaces := &container.Namespaces{
+			Pid: context.String("pid"),
+			Ipc: context.String("ipc"),
+			Uts: context.String("uts"),
+		}
+		if _, ok := container.NamespaceContainer(network); ok || network == container.NamespaceModeHost {
+			namespaces.Net = network
+			network = ""
+		}
+		// pod container joins net/ipc/uts namespaces of infra container
+		var pod *container.Pod
+		if podName := context.String("pod"); podName != "" {
+			if network != "" || len(portMapping) > 0 || namespaces.Ipc != "" || namespaces.Uts != "" {
+				return fmt.Errorf("conflicting options: --pod and --net/-p/--ipc/--uts")
+			}
+			if pod, err = container.LoadPod(containerPaths(), podName); err != nil {
+				return err
+			}
+			infraMode := "container:" + pod.InfraContainer
+			namespaces.Net, namespaces.Ipc, namespaces.Uts = infraMode, infraMode, infraMode
+		}
+		if err := namespaces.Validate(container.IsRootless()); err != nil {
+			return err
+		}
+		if !container.IsPrivateNamespace(namespaces.Uts) && (context.String("hostname") != "" || context.String("domainname") != "") {
+			return fmt.Errorf("conflicting options: --hostname/--domainname and --uts %s", namespaces.Uts)
+		}
+		sysctls, err := container.ParseSysctls(context.StringSlice("sysctl"),
+			container.IsPrivateNamespace(namespaces.Net), container.IsPrivateNamespace(namespaces.Ipc))
+		if err != nil {
+			return err
+		}
+		cgroupNS := context.String("cgroupns")
+		if err := container.ValidateCgroupNS(cgroupNS); err != nil {
+			return err
+		}
+		timeOffsets, err := container.ParseTimeOffsets(context.String("time-offset"))
+		if err != nil {
+			return err
+		}
+		initConf := &container.InitConfig{
+			Args:          cmdArray,
+			Capabilities:  caps,
+			Privileged:    privileged,
+			SeccompFilter: seccompFilter,
+			ReadOnly:      context.Bool("read-only"),
+			Tmpfs:         tmpfs,
+			ShmSize:       shmSize,
+			Hostname:      context.String("hostname"),
+			Domainname:    context.String("domainname"),
+			Rlimits:       rlimits,
+			Sysctls:       sysctls,
+			CgroupNS:      cgroupNS,
+			TimeOffsets:   timeOffsets,
+		}
+		if context.IsSet("oom-score-adj") {
+			oomScoreAdj := context.Int("oom-score-adj")
+			if err := container.ValidateOomScoreAdj(oomScoreAdj); err != nil {
+				return err
+			}
+			initConf.OomScoreAdj = &oomScoreAdj
+		}
+		// privileged container can access all kernel paths
+		if !privileged {
+			initConf.MaskedPaths = container.DefaultMaskedPaths
+			initConf.ReadonlyPaths = container.DefaultReadonlyPaths
+		}
+		labels, err := container.ParseLabels(context.StringSlice("label"), context.StringSlice("label-file"))
+		if err != nil {
+			return err
+		}
+		logOpts, err := logger.ParseLogOpts(context.StringSlice("log-opt"))
+		if err != nil {
+			return err
+		}
+		// without --log-driver, log-opts of config file apply and --log-opt overrides them
+		logDriver := context.String("log-driver")
+		if logDriver == "" {
+			logDriver = globalConfig.LogDriver
+			for key, value := range globalConfig.LogOpts {
+				if _, ok := logOpts[key]; !ok {
+					logOpts[key] = value
+				}
+			}
+		}
+		if err := logger.ValidateLogConfig(logDriver, logOpts); err != nil {
+			return err
+		}
+		logConfig := &container.LogConfig{Type: logDriver, Config: logOpts}
+		// detached container is started by a monitor process which outlives mydocker run
+		if !tty && os.Getenv(EnvMonitor) == "" {
+			return startMonitor()
+		}
 		// start container process
-		Run(tty, cmdArray, resConfig, volume, containerName, imageName, envSlice, network, portMapping)
-		return nil
+		return Run(tty, initConf, resConfig, volume, containerName, imageName, envSlice, network, portMapping, seccompOpt, namespaces, pod, labels, logConfig)
 	},
 }
 
@@ -126,47 +350,332 @@ var initCommand = cli.Command{
 }
 
 /**
- * usage: ./Mydocker commit containerName
+ * logger process reading stdout of detached container from stdin and stderr from fd 3
+ */
+var loggerCommand = cli.Command{
+	Name:   "logger",
+	Usage:  "Write container output into log file. Do not call it outside",
+	Hidden: true,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "log-driver",
+			Usage: "log driver",
+		},
+		cli.StringSliceFlag{
+			Name:  "log-opt",
+			Usage: "log driver options",
+		},
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "container id",
+		},
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "container name",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing log path")
+		}
+		logOpts, err := logger.ParseLogOpts(context.StringSlice("log-opt"))
+		if err != nil {
+			return err
+		}
+		info := &logger.DriverInfo{
+			ContainerID:   context.String("id"),
+			ContainerName: context.String("name"),
+			LogPath:       context.Args().Get(0),
+			Config:        logOpts,
+		}
+		return logger.Run(context.String("log-driver"), info, os.Stdin, os.NewFile(3, "stderr"))
+	},
+}
+
+/**
+ * pod infra process holding namespaces of pod
+ */
+var pauseCommand = cli.Command{
+	Name:   "pause",
+	Usage:  "Hold namespaces of pod. Do not call it outside",
+	Hidden: true,
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing pod name")
+		}
+		return container.Pause(context.Args().Get(0))
+	},
+}
+
+/**
+ * Usage:
+ * ./Mydocker pod create --net testnet -p 8080:80 web
+ * ./Mydocker pod ps
+ * ./Mydocker pod inspect web
+ * ./Mydocker pod rm web
+ */
+var podCommand = cli.Command{
+	Name:  "pod",
+	Usage: "manage pods which share network and ipc namespaces",
+	Subcommands: []cli.Command{
+		{
+			Name:  "create",
+			Usage: "create a pod",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "net",
+					Usage: "pod network",
+				},
+				cli.StringSliceFlag{
+					Name:  "p",
+					Usage: "port mapping",
+				},
+				cli.StringFlag{
+					Name:  "mem",
+					Usage: "memory limit of pod",
+				},
+				cli.StringFlag{
+					Name:  "cpu",
+					Usage: "cpu quota of pod",
+				},
+				cli.StringFlag{
+					Name:  "cpuset",
+					Usage: "cpuset limit of pod",
+				},
+				cli.StringSliceFlag{
+					Name:  "label",
+					Usage: "set metadata on pod, e.g. --label team=infra",
+				},
+				cli.StringSliceFlag{
+					Name:  "label-file",
+					Usage: "read in a line delimited file of labels",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("missing pod name")
+				}
+				resConfig := &subsystems.ResourceConfig{
+					MemoryLimit: context.String("mem"),
+					CpuCfsQuota: context.Int("cpu"),
+					CpuSet:      context.String("cpuset"),
+				}
+				labels, err := container.ParseLabels(context.StringSlice("label"), context.StringSlice("label-file"))
+				if err != nil {
+					return err
+				}
+				return CreatePod(context.Args().Get(0), context.String("net"), context.StringSlice("p"), resConfig, labels)
+			},
+		},
+		{
+			Name:  "rm",
+			Usage: "remove a pod without containers",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("missing pod name")
+				}
+				return RemovePod(context.Args().Get(0))
+			},
+		},
+		{
+			Name:  "ps",
+			Usage: "list all the pods",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "filter",
+					Usage: "filter output by label, e.g. label=team or label=team=infra",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				labelFilters, err := parseLabelFilters(context.StringSlice("filter"))
+				if err != nil {
+					return err
+				}
+				ListPods(labelFilters)
+				return nil
+			},
+		},
+		{
+			Name:  "inspect",
+			Usage: "display detailed information of a pod",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("missing pod name")
+				}
+				return InspectPod(context.Args().Get(0))
+			},
+		},
+	},
+}
+
+/**
+ * usage: ./Mydocker commit [--label k=v] containerName imageName
  */
 var commitCommand = cli.Command{
 	Name:  "commit",
 	Usage: "commit container to image",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set metadata, e.g. team=infra",
+		},
+		cli.StringSliceFlag{
+			Name:  "label-file",
+			Usage: "read in a line delimited file of labels",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("missing imageName")
 		}
-		containerName := context.Args().Get(0)
+		info, err := resolveContainer(context.Args().Get(0))
+		if err != nil {
+			return err
+		}
 		imageName := context.Args().Get(1)
-		container.Commit(containerName, imageName)
+		labels, err := container.ParseLabels(context.StringSlice("label"), context.StringSlice("label-file"))
+		if err != nil {
+			return err
+		}
+		if err := container.Commit(containerPaths(), info, imageName, labels); err != nil {
+			return err
+		}
+		eventJournal().Log(events.TypeImage, events.ActionCommit, imageName, map[string]string{"container": info.Id, "containerName": info.Name})
 		return nil
 	},
 }
 
 /**
- * usage: ./Mydocker ps
+ * usage: ./Mydocker ps [-a] [-q] [--filter status=running] [--format json]
  */
 var listCommand = cli.Command{
 	Name:  "ps",
-	Usage: "list all the containers",
+	Usage: "list containers",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "a",
+			Usage: "show all containers, only running containers are shown by default",
+		},
+		cli.BoolFlag{
+			Name:  "q",
+			Usage: "only display container ids",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "filter output, e.g. status=created|running|exited, name=web, label=env=prod, network=testnet, ancestor=busybox",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table, json or go template, e.g. '{{.ID}} {{.Status}}'",
+		},
+		cli.BoolFlag{
+			Name:  "no-trunc",
+			Usage: "don't truncate output",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		ListContainers()
-		return nil
+		filters, err := container.ParsePsFilters(context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
+		return ListContainers(&psOptions{
+			all:     context.Bool("a"),
+			quiet:   context.Bool("q"),
+			filters: filters,
+			format:  context.String("format"),
+			noTrunc: context.Bool("no-trunc"),
+		})
 	},
 }
 
 /**
- * Usage: ./Mydocker logs containerName
+ * Usage: ./Mydocker inspect [--type container|image|network|volume] [--format '{{.NetworkSettings.IPAddress}}'] name
+ */
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information of a container, image, network or volume",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: "format the output using the given go template",
+		},
+		cli.StringFlag{
+			Name:  "type",
+			Usage: "only inspect object of the given type: container, image, network or volume",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing object name")
+		}
+		return Inspect(context.Args().Get(0), context.String("type"), context.String("format"))
+	},
+}
+
+/**
+ * Usage: ./Mydocker logs [-f] [--tail 10] [--since 10m] [--until 2024-01-01T00:00:00Z] [-t] [--stdout|--stderr] containerName
  */
 var logCommand = cli.Command{
 	Name:  "logs",
 	Usage: "print logs of a container",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "follow log output until container exits",
+		},
+		cli.StringFlag{
+			Name:  "tail",
+			Value: "all",
+			Usage: "number of lines to show from the end of the logs",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "show logs since timestamp (e.g. 2024-01-01T00:00:00Z) or relative (e.g. 10m)",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Usage: "show logs before timestamp (e.g. 2024-01-01T00:00:00Z) or relative (e.g. 10m)",
+		},
+		cli.BoolFlag{
+			Name:  "timestamps, t",
+			Usage: "show timestamps",
+		},
+		cli.BoolFlag{
+			Name:  "stdout",
+			Usage: "only show stdout stream",
+		},
+		cli.BoolFlag{
+			Name:  "stderr",
+			Usage: "only show stderr stream",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("please input your containerName")
 		}
-		containerName := context.Args().Get(0)
-		LogContainer(containerName)
-		return nil
+		opts := &logger.ReadOptions{
+			Tail:       -1,
+			Follow:     context.Bool("follow"),
+			Timestamps: context.Bool("timestamps"),
+			Stdout:     context.Bool("stdout"),
+			Stderr:     context.Bool("stderr"),
+		}
+		if tail := context.String("tail"); tail != "all" {
+			n, err := strconv.Atoi(tail)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid --tail %s, should be a non-negative number or all", tail)
+			}
+			opts.Tail = n
+		}
+		now := time.Now()
+		var err error
+		if opts.Since, err = logger.ParseTime(context.String("since"), now); err != nil {
+			return err
+		}
+		if opts.Until, err = logger.ParseTime(context.String("until"), now); err != nil {
+			return err
+		}
+		return LogContainer(context.Args().Get(0), opts)
 	},
 }
 
@@ -214,14 +723,22 @@ var stopCommand = cli.Command{
  */
 var removeCommand = cli.Command{
 	Name:  "rm",
-	Usage: "remove unused containers",
+	Usage: "remove one or more containers",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "force the removal of a running container (uses SIGKILL)",
+		},
+		cli.BoolFlag{
+			Name:  "volumes, v",
+			Usage: "remove host directories of volumes created by mydocker and not used by other containers",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
 			return fmt.Errorf("missing container name")
 		}
-		containerName := context.Args().Get(0)
-		RemoveContainer(containerName)
-		return nil
+		return RemoveContainers(context.Args(), context.Bool("force"), context.Bool("volumes"))
 	},
 }
 
@@ -250,32 +767,55 @@ var networkCommand = cli.Command{
 					Name:  "subnet",
 					Usage: "subnet cidr",
 				},
+				cli.StringSliceFlag{
+					Name:  "label",
+					Usage: "set metadata, e.g. team=infra",
+				},
+				cli.StringSliceFlag{
+					Name:  "label-file",
+					Usage: "read in a line delimited file of labels",
+				},
 			},
 			Action: func(context *cli.Context) error {
 				if len(context.Args()) < 1 {
 					return fmt.Errorf("missing network name")
 				}
 				// load network-configuration by dumpFile
-				err := network.Init()
+				err := initNetwork()
 				if err != nil {
 					return fmt.Errorf("network init failed %v", err)
 				}
-				err = network.CreateNetwork(context.String("driver"), context.String("subnet"), context.Args()[0])
+				labels, err := container.ParseLabels(context.StringSlice("label"), context.StringSlice("label-file"))
+				if err != nil {
+					return err
+				}
+				err = network.CreateNetwork(context.String("driver"), context.String("subnet"), context.Args()[0], labels)
 				if err != nil {
 					return fmt.Errorf("create network failed %v", err)
 				}
+				eventJournal().LogNetwork(events.ActionCreate, context.Args()[0], nil)
 				return nil
 			},
 		},
 		{
 			Name:  "list",
 			Usage: "list container network",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "filter",
+					Usage: "filter output by label, e.g. label=team or label=team=infra",
+				},
+			},
 			Action: func(context *cli.Context) error {
-				err := network.Init()
+				labelFilters, err := parseLabelFilters(context.StringSlice("filter"))
+				if err != nil {
+					return err
+				}
+				err = initNetwork()
 				if err != nil {
 					return fmt.Errorf("network init failed %v", err)
 				}
-				network.ListNetwork()
+				network.ListNetwork(labelFilters)
 				return nil
 			},
 		},
@@ -286,12 +826,100 @@ var networkCommand = cli.Command{
 				if len(context.Args()) < 1 {
 					return fmt.Errorf("missing network name")
 				}
-				network.Init()
+				initNetwork()
 				if err := network.DeleteNetwork(context.Args()[0]); err != nil {
 					return fmt.Errorf("remove network %s configuration-file failed", context.Args()[0])
 				}
+				eventJournal().LogNetwork(events.ActionDestroy, context.Args()[0], nil)
 				return nil
 			},
 		},
 	},
 }
+
+/**
+ * Usage:
+ * ./Mydocker system check
+ * ./Mydocker system prune -f
+ */
+var systemCommand = cli.Command{
+	Name:  "system",
+	Usage: "reconcile container state and reclaim leaked resources",
+	Subcommands: []cli.Command{
+		{
+			Name:  "check",
+			Usage: "mark dead containers exited and report leaked resources",
+			Action: func(context *cli.Context) error {
+				return SystemCheck()
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "remove stopped containers, unused networks, dangling images and leaked resources",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "do not prompt for confirmation",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				return SystemPrune(context.Bool("force"))
+			},
+		},
+	},
+}
+
+/**
+ * Usage: ./Mydocker events [--since 10m] [--until 2024-01-01T00:00:00Z] [--filter key=value] [--format json]
+ * replay recorded events and then follow new ones, stops at --until if given
+ */
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "show lifecycle events of containers, networks and images",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "show events since timestamp (e.g. 2024-01-01T00:00:00Z) or relative (e.g. 10m)",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Usage: "stream events until timestamp (e.g. 2024-01-01T00:00:00Z) or relative (e.g. 10m)",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter, f",
+			Usage: "filter events by type, event, container, image, network or label, e.g. --filter event=die",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: "text",
+			Usage: "output format, text or json",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		format := context.String("format")
+		if format != "text" && format != "json" {
+			return fmt.Errorf("invalid --format %s, should be text or json", format)
+		}
+		filters, err := events.ParseFilters(context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		since, err := logger.ParseTime(context.String("since"), now)
+		if err != nil {
+			return err
+		}
+		until, err := logger.ParseTime(context.String("until"), now)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		return eventJournal().Read(since, until, filters, func(e *events.Event) error {
+			if format == "json" {
+				return encoder.Encode(e)
+			}
+			fmt.Println(e.String())
+			return nil
+		})
+	},
+}
@@ -11,6 +11,8 @@ const (
 	META      Category = 0x04
 	NETWORK   Category = 0x05
 	NSENTER   Category = 0x06
+	STATE     Category = 0x07
+	EVENTS    Category = 0x08
 )
 
 const CGROUP_PATH = "mydocker-cgroup"
@@ -29,6 +31,10 @@ func (ce Category) String() string {
 		return "network"
 	case NSENTER:
 		return "nsenter"
+	case STATE:
+		return "state"
+	case EVENTS:
+		return "events"
 	default:
 		return "CATEGORY " + strconv.Itoa(int(ce))
 	}
@@ -1,6 +1,7 @@
 package meta
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -43,6 +44,10 @@ const (
 	ErrDriverExec
 	// network-ipam exec failed
 	ErrIpamExec
+	// already exists
+	ErrExists
+	// concurrent modification
+	ErrConflict
 )
 
 var errMap = map[ErrCode]string{
@@ -61,6 +66,8 @@ var errMap = map[ErrCode]string{
 	ErrIptables:        "iptables exec failed",
 	ErrDriverExec:      "network driver exec failed",
 	ErrIpamExec:        "network ipam exec failed",
+	ErrExists:          "already exists",
+	ErrConflict:        "conflict",
 }
 
 func NewErrorCode(behavior ErrCode, category Category) ErrCode {
@@ -116,9 +123,20 @@ func (err Error) Message() string {
 // Error return error message,
 // combining category, behavior and message
 func (err Error) Error() string {
-	return fmt.Sprintf("[%s] %s: %s", err.Code.Category(), err.Code.Behavior(), err)
+	return fmt.Sprintf("[%s] %s: %s", err.Code.Category(), err.Code.Behavior(), err.Message())
 }
 
 func (err Error) Unwrap() error {
 	return err.Err
 }
+
+// HasBehavior reports whether any Error in err's chain has the behavior
+func HasBehavior(err error, behavior ErrCode) bool {
+	for err != nil {
+		if e, ok := err.(Error); ok && e.Code.Behavior() == behavior {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
@@ -83,9 +83,19 @@ func (d *BridgeNetworkDriver) Connect(network *Network, endPoint *EndPoint) erro
 }
 
 /**
- * 断开网络连接
+ * 断开网络连接——删除 veth-bridge 设备，容器端设备随之删除
  */
 func (d *BridgeNetworkDriver) Disconnect(network Network, endpoint *EndPoint) error {
+	link, err := netlink.LinkByName(endpoint.Device.Name)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return meta.NewError(meta.NewErrorCode(meta.ErrLink, meta.NETWORK), fmt.Sprintf("retrieving link %s failed", endpoint.Device.Name), err)
+	}
+	if err := netlink.LinkDel(link); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrLink, meta.NETWORK), fmt.Sprintf("delete Endpoint device %s failed", endpoint.Device.Name), err)
+	}
 	return nil
 }
 
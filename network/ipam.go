@@ -153,3 +153,34 @@ func (ipam *IPAM) Release(subnet *net.IPNet, ipaddr *net.IP) error {
 	}
 	return nil
 }
+
+/**
+ * 网段下已分配的全部 IP 地址，包括网关
+ */
+func (ipam *IPAM) allocated(subnet *net.IPNet) ([]net.IP, error) {
+	ipam.Subnets = &map[string]string{}
+	if err := ipam.load(); err != nil {
+		return nil, err
+	}
+	_, subnet, _ = net.ParseCIDR(subnet.String())
+	var ips []net.IP
+	for idx, c := range (*ipam.Subnets)[subnet.String()] {
+		if c == '1' {
+			ips = append(ips, ipAt(subnet, idx))
+		}
+	}
+	return ips, nil
+}
+
+/**
+ * 位图索引对应的 IP 地址，与 Allocate 的计算方式一致
+ */
+func ipAt(subnet *net.IPNet, idx int) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, subnet.IP.To4())
+	for t := uint(4); t > 0; t-- {
+		ip[4-t] += uint8(idx >> ((t - 1) * 8))
+	}
+	ip[3] += 1
+	return ip
+}
@@ -11,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -20,7 +21,8 @@ import (
 )
 
 var (
-	defaultNetworkPath = "/var/run/Mydocker/network/network/"
+	// 网络配置文件目录，Init 根据网络状态目录设置
+	networkPath = "/var/run/Mydocker/network/network/"
 	// 系统网络驱动
 	drivers = map[string]Driver{}
 	// 系统网络
@@ -31,9 +33,10 @@ var (
  * 网络信息
  */
 type Network struct {
-	Name    string     // 网络名
-	IPRange *net.IPNet // 地址段
-	Driver  string     // 网络驱动名
+	Name    string            // 网络名
+	IPRange *net.IPNet        // 地址段
+	Driver  string            // 网络驱动名
+	Labels  map[string]string // 网络标签
 }
 
 /**
@@ -98,22 +101,25 @@ func (nw *Network) remove(filePath string) error {
 
 /**
  * 初始加载系统网络配置
+ * dir 为网络状态目录，网络配置位于 dir/network，IPAM 记录位于 dir/ipam/subnet.json
  */
-func Init() error {
+func Init(dir string) error {
+	networkPath = path.Join(dir, "network") + "/"
+	ipAllocator.SubnetAllocPath = path.Join(dir, "ipam", "subnet.json")
 	// 加载桥接网络驱动
 	var bridgeDriver = BridgeNetworkDriver{}
 	drivers[bridgeDriver.Name()] = &bridgeDriver
 	// 创建网络配置文件目录
-	if _, err := os.Stat(defaultNetworkPath); err != nil {
+	if _, err := os.Stat(networkPath); err != nil {
 		if !os.IsNotExist(err) {
-			return meta.NewError(meta.ErrRead, fmt.Sprintf("stat filePath %s failed", defaultNetworkPath), err)
+			return meta.NewError(meta.ErrRead, fmt.Sprintf("stat filePath %s failed", networkPath), err)
 		}
-		if err = os.MkdirAll(defaultNetworkPath, container.Perm0644); err != nil {
-			return meta.NewError(meta.ErrConvert, fmt.Sprintf("mkdir filePath %s failed", defaultNetworkPath), err)
+		if err = os.MkdirAll(networkPath, container.Perm0644); err != nil {
+			return meta.NewError(meta.ErrConvert, fmt.Sprintf("mkdir filePath %s failed", networkPath), err)
 		}
 	}
 	// 检查网络配置目录下文件，解析生成相应 Network 对象
-	err := filepath.Walk(defaultNetworkPath, func(nwPath string, info os.FileInfo, err error) error {
+	err := filepath.Walk(networkPath, func(nwPath string, info os.FileInfo, err error) error {
 		if info.IsDir() {
 			return nil
 		}
@@ -128,7 +134,7 @@ func Init() error {
 		return nil
 	})
 	if err != nil {
-		return meta.NewError(meta.ErrRead, fmt.Sprintf("walk network-file %s failed", defaultNetworkPath), err)
+		return meta.NewError(meta.ErrRead, fmt.Sprintf("walk network-file %s failed", networkPath), err)
 	}
 	return nil
 }
@@ -157,7 +163,7 @@ func (nw *Network) load(filePath string) error {
 /**
  * 创建网络对象并持久化存储
  */
-func CreateNetwork(driver, subnet, name string) error {
+func CreateNetwork(driver, subnet, name string, labels map[string]string) error {
 	_, cidr, _ := net.ParseCIDR(subnet)
 	// IPAM 获取可用 IP 地址
 	ip, err := ipAllocator.Allocate(cidr)
@@ -169,16 +175,43 @@ func CreateNetwork(driver, subnet, name string) error {
 	if err != nil {
 		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("driver %s exec failed", driver), err)
 	}
-	return nw.dump(defaultNetworkPath)
+	nw.Labels = labels
+	return nw.dump(networkPath)
 }
 
 /**
- * 展示网络配置列表
+ * 获取指定网络配置
  */
-func ListNetwork() {
+func GetNetwork(networkName string) (*Network, error) {
+	nw, ok := networks[networkName]
+	if !ok {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.NETWORK), fmt.Sprintf("can't find network %s", networkName), nil)
+	}
+	return nw, nil
+}
+
+/**
+ * 所有网络名，按名称排序
+ */
+func Names() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+ * 展示网络配置列表，labelFilters 为 label=k 或 label=k=v 过滤条件，全部满足时展示
+ */
+func ListNetwork(labelFilters []string) {
 	writer := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	fmt.Fprint(writer, "NAME\tIpRange\tDriver\n")
 	for _, nw := range networks {
+		if !matchLabels(nw.Labels, labelFilters) {
+			continue
+		}
 		fmt.Fprintf(writer, "%s\t%s\t%s\n",
 			nw.Name,
 			nw.IPRange.String(),
@@ -191,6 +224,15 @@ func ListNetwork() {
 	}
 }
 
+func matchLabels(labels map[string]string, labelFilters []string) bool {
+	for _, filter := range labelFilters {
+		if !container.MatchLabel(labels, filter) {
+			return false
+		}
+	}
+	return true
+}
+
 /**
  * 删除指定网络配置
  * 1.释放IPAM分配的ip地址；
@@ -211,14 +253,14 @@ func DeleteNetwork(networkName string) error {
 		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("remove network driver %s failed", nw.Driver), err)
 	}
 	// 删除网络配置文件
-	return nw.remove(defaultNetworkPath)
+	return nw.remove(networkPath)
 }
 
 /**
  * Usage：./Mydocker run -net testnet -p 8080:80 xxxx
- * 连接容器到历史创建的网络
+ * 连接容器到历史创建的网络，失败时释放已分配的 IP、veth 设备和端口映射
  */
-func Connect(networkName string, info *container.Info) error {
+func Connect(paths *container.Paths, networkName string, info *container.Info) (err error) {
 	network, ok := networks[networkName]
 	if !ok {
 		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.NETWORK), fmt.Sprintf("can't find network %s", networkName), nil)
@@ -235,6 +277,11 @@ func Connect(networkName string, info *container.Info) error {
 		Network:     network,
 		PortMapping: info.PortMapping,
 	}
+	defer func() {
+		if err != nil {
+			releaseEndpoint(point)
+		}
+	}()
 	// 挂载 veth-bridge 设备
 	if err = drivers[network.Driver].Connect(network, point); err != nil {
 		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("veth-pair connect bridge and container failed, networkName: %s", networkName), err)
@@ -243,10 +290,73 @@ func Connect(networkName string, info *container.Info) error {
 	if err = configEndpointIpAddressAndRoute(point, info); err != nil {
 		return meta.NewError(meta.NewErrorCode(meta.ErrLink, meta.NETWORK), "config veth-pair ip address of namespace failed", err)
 	}
+	// 添加容器 IP 的 hosts 记录
+	if err = container.AddHostsEntry(paths, info.Name, containerIp.String(), info.Hostname, info.Domainname); err != nil {
+		log.Errorf("add hosts entry for %s failed %v", info.Name, err)
+	}
+	// 记录容器网络端点
+	prefixLen, _ := network.IPRange.Mask.Size()
+	info.NetworkSettings = container.NetworkSettings{
+		Network:     networkName,
+		EndpointID:  point.ID,
+		IPAddress:   containerIp.String(),
+		IPPrefixLen: prefixLen,
+		Gateway:     network.IPRange.IP.String(),
+		MacAddress:  point.MacAddress.String(),
+		HostVeth:    point.Device.Name,
+		ContainerIf: point.Device.PeerName,
+		Ports:       point.PortMapping,
+	}
 	// 配置容器端口和宿主机端口映射
 	return configPortMapping(point)
 }
 
+/**
+ * 断开容器与网络的连接：删除端口映射、veth 设备，释放 IP
+ */
+func Disconnect(paths *container.Paths, info *container.Info) error {
+	settings := info.NetworkSettings
+	network, ok := networks[settings.Network]
+	if !ok {
+		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.NETWORK), fmt.Sprintf("can't find network %s", settings.Network), nil)
+	}
+	point := &EndPoint{
+		ID:          settings.EndpointID,
+		IPAddress:   net.ParseIP(settings.IPAddress),
+		Network:     network,
+		PortMapping: settings.Ports,
+	}
+	point.Device.Name = settings.HostVeth
+	if err := releaseEndpoint(point); err != nil {
+		return err
+	}
+	return container.RemoveHostsEntry(paths, info.Name, settings.IPAddress)
+}
+
+/**
+ * 释放网络端点占用的资源，已释放或未创建的资源跳过
+ */
+func releaseEndpoint(point *EndPoint) error {
+	removePortMapping(point)
+	var result error
+	if point.Device.Name != "" {
+		if err := drivers[point.Network.Driver].Disconnect(*point.Network, point); err != nil {
+			log.Errorf("disconnect endpoint %s failed %v", point.ID, err)
+			result = err
+		}
+	}
+	if ip := point.IPAddress.To4(); ip != nil {
+		// Release 会修改传入的 IP
+		released := make(net.IP, len(ip))
+		copy(released, ip)
+		if err := ipAllocator.Release(point.Network.IPRange, &released); err != nil {
+			log.Errorf("release ip %s failed %v", point.IPAddress, err)
+			result = err
+		}
+	}
+	return result
+}
+
 /**
  * 配置容器网络端点（veth-container）的地址和路由
  */
@@ -270,6 +380,10 @@ func configEndpointIpAddressAndRoute(point *EndPoint, info *container.Info) erro
 	if err = setInterfaceUP(point.Device.PeerName); err != nil {
 		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("startUp veth-container %s failed", point.Device.PeerName), err)
 	}
+	// 记录容器端veth设备的Mac地址
+	if link, err := netlink.LinkByName(point.Device.PeerName); err == nil {
+		point.MacAddress = link.Attrs().HardwareAddr
+	}
 	// 配置本地回环地址
 	if err = setInterfaceUP("lo"); err != nil {
 		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), "startUp lo-device failed", err)
@@ -336,8 +450,7 @@ func configPortMapping(point *EndPoint) error {
 			continue
 		}
 		// iptables 配置端口映射路由
-		iptablesCmd := fmt.Sprintf("-t nat -A PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
-			mappings[0], point.IPAddress.String(), mappings[1])
+		iptablesCmd := portMappingRule("-A", mappings[0], point.IPAddress.String(), mappings[1])
 		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
 		log.Infof("set portMapping for container, cmd: %s", cmd)
 		output, err := cmd.Output()
@@ -348,3 +461,24 @@ func configPortMapping(point *EndPoint) error {
 	}
 	return err
 }
+
+/**
+ * 删除容器的端口映射规则
+ */
+func removePortMapping(point *EndPoint) {
+	for _, pm := range point.PortMapping {
+		mappings := strings.Split(pm, ":")
+		if len(mappings) != 2 {
+			continue
+		}
+		iptablesCmd := portMappingRule("-D", mappings[0], point.IPAddress.String(), mappings[1])
+		if output, err := exec.Command("iptables", strings.Split(iptablesCmd, " ")...).CombinedOutput(); err != nil {
+			log.Warnf("remove portMapping %s failed, output:%s", pm, output)
+		}
+	}
+}
+
+func portMappingRule(action, hostPort, containerIP, containerPort string) string {
+	return fmt.Sprintf("-t nat %s PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+		action, hostPort, containerIP, containerPort)
+}
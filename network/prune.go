@@ -0,0 +1,170 @@
+package network
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+/**
+ * 泄漏的网络资源：容器异常退出或宿主机重启后，没有容器端点使用的 IP、veth 设备和端口映射规则
+ * Usage：./Mydocker system check、./Mydocker system prune
+ */
+type Leak struct {
+	Kind     string       // ip、veth、iptables
+	Network  string       // 所属网络
+	Resource string       // IP 地址、设备名或端口映射规则
+	Release  func() error // 释放该资源
+}
+
+const (
+	LeakIP       = "ip"
+	LeakVeth     = "veth"
+	LeakIPTables = "iptables"
+)
+
+/**
+ * 对比容器记录的网络端点找出泄漏的网络资源，调用前需要 Init 加载网络
+ * endpoints 为仍持有网络端点的容器网络设置
+ */
+func FindLeaks(endpoints []container.NetworkSettings) ([]*Leak, error) {
+	usedIPs := map[string]bool{}
+	usedVeths := map[string]bool{}
+	usedRules := map[string]bool{}
+	for _, settings := range endpoints {
+		usedIPs[settings.Network+"/"+settings.IPAddress] = true
+		usedVeths[settings.HostVeth] = true
+		for _, pm := range settings.Ports {
+			if mappings := strings.Split(pm, ":"); len(mappings) == 2 {
+				usedRules[dnatKey(mappings[0], settings.IPAddress, mappings[1])] = true
+			}
+		}
+	}
+	var leaks []*Leak
+	bridges := map[int]string{}
+	for _, nw := range networks {
+		if nw.IPRange == nil {
+			continue
+		}
+		ips, err := ipAllocator.allocated(nw.IPRange)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if ip.Equal(nw.IPRange.IP) || usedIPs[nw.Name+"/"+ip.String()] {
+				continue
+			}
+			leaks = append(leaks, ipLeak(nw, ip))
+		}
+		if link, err := netlink.LinkByName(nw.Name); err == nil {
+			bridges[link.Attrs().Index] = nw.Name
+		}
+	}
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrLink, meta.NETWORK), "list links failed", err)
+	}
+	for _, link := range links {
+		attrs := link.Attrs()
+		nwName, ok := bridges[attrs.MasterIndex]
+		if link.Type() != "veth" || !ok || usedVeths[attrs.Name] {
+			continue
+		}
+		leaks = append(leaks, vethLeak(nwName, link))
+	}
+	// 没有 iptables 时也就没有端口映射规则
+	rules, err := exec.Command("iptables", "-t", "nat", "-S", "PREROUTING").Output()
+	if err != nil {
+		log.Warnf("list iptables nat rules failed %v", err)
+		return leaks, nil
+	}
+	for _, rule := range strings.Split(string(rules), "\n") {
+		hostPort, containerIP, containerPort, ok := parseDNATRule(rule)
+		if !ok || usedRules[dnatKey(hostPort, containerIP, containerPort)] {
+			continue
+		}
+		for _, nw := range networks {
+			if nw.IPRange != nil && nw.IPRange.Contains(net.ParseIP(containerIP)) {
+				leaks = append(leaks, dnatLeak(nw.Name, hostPort, containerIP, containerPort))
+				break
+			}
+		}
+	}
+	return leaks, nil
+}
+
+func ipLeak(nw *Network, ip net.IP) *Leak {
+	return &Leak{
+		Kind:     LeakIP,
+		Network:  nw.Name,
+		Resource: ip.String(),
+		Release: func() error {
+			return ipAllocator.Release(nw.IPRange, &ip)
+		},
+	}
+}
+
+func vethLeak(nwName string, link netlink.Link) *Leak {
+	return &Leak{
+		Kind:     LeakVeth,
+		Network:  nwName,
+		Resource: link.Attrs().Name,
+		Release: func() error {
+			if err := netlink.LinkDel(link); err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrLink, meta.NETWORK), fmt.Sprintf("delete veth %s failed", link.Attrs().Name), err)
+			}
+			return nil
+		},
+	}
+}
+
+func dnatLeak(nwName, hostPort, containerIP, containerPort string) *Leak {
+	return &Leak{
+		Kind:     LeakIPTables,
+		Network:  nwName,
+		Resource: fmt.Sprintf("%s -> %s:%s", hostPort, containerIP, containerPort),
+		Release: func() error {
+			rule := portMappingRule("-D", hostPort, containerIP, containerPort)
+			if output, err := exec.Command("iptables", strings.Split(rule, " ")...).CombinedOutput(); err != nil {
+				return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("remove portMapping %s failed, output:%s", rule, output), err)
+			}
+			return nil
+		},
+	}
+}
+
+func dnatKey(hostPort, containerIP, containerPort string) string {
+	return hostPort + "->" + containerIP + ":" + containerPort
+}
+
+/**
+ * 解析 iptables -S 输出的端口映射规则，格式与 portMappingRule 一致
+ * -A PREROUTING -p tcp -m tcp --dport 8080 -j DNAT --to-destination 192.168.0.2:80
+ */
+func parseDNATRule(rule string) (hostPort, containerIP, containerPort string, ok bool) {
+	fields := strings.Fields(rule)
+	if len(fields) < 2 || fields[0] != "-A" || fields[1] != "PREROUTING" {
+		return "", "", "", false
+	}
+	var dnat bool
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "--dport":
+			hostPort = fields[i+1]
+		case "-j":
+			dnat = fields[i+1] == "DNAT"
+		case "--to-destination":
+			if idx := strings.LastIndex(fields[i+1], ":"); idx > 0 {
+				containerIP, containerPort = fields[i+1][:idx], fields[i+1][idx+1:]
+			}
+		}
+	}
+	ok = dnat && hostPort != "" && containerIP != "" && containerPort != ""
+	return
+}
@@ -0,0 +1,32 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseDNATRule(t *testing.T) {
+	hostPort, ip, port, ok := parseDNATRule("-A PREROUTING -p tcp -m tcp --dport 8080 -j DNAT --to-destination 192.168.0.2:80")
+	if !ok || hostPort != "8080" || ip != "192.168.0.2" || port != "80" {
+		t.Fatalf("unexpected rule %s %s %s %v", hostPort, ip, port, ok)
+	}
+	for _, rule := range []string{
+		"-P PREROUTING ACCEPT",
+		"-A PREROUTING -m addrtype --dst-type LOCAL -j DOCKER",
+		"-A POSTROUTING -s 192.168.0.0/24 ! -o testnet -j MASQUERADE",
+	} {
+		if _, _, _, ok := parseDNATRule(rule); ok {
+			t.Errorf("%q is not a port mapping rule", rule)
+		}
+	}
+}
+
+func TestIPAt(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.0.0/24")
+	if ip := ipAt(subnet, 0); ip.String() != "192.168.0.1" {
+		t.Fatalf("unexpected gateway %s", ip)
+	}
+	if ip := ipAt(subnet, 4); ip.String() != "192.168.0.5" {
+		t.Fatalf("unexpected ip %s", ip)
+	}
+}
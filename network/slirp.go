@@ -0,0 +1,176 @@
+package network
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * rootless 模式无法创建网桥和 veth 设备，使用 slirp4netns 用户态网络栈
+ * Usage：./Mydocker run -net slirp4netns -p 8080:80 xxxx
+ */
+
+const (
+	SlirpNetworkName = "slirp4netns"
+	slirpTapName     = "tap0"
+	slirpMtu         = "65520"
+	slirpApiSocket   = "slirp4netns.sock"
+	slirpPidFile     = "slirp4netns.pid"
+	// slirp4netns --configure 分配的容器地址和内置 DNS
+	slirpGuestIP     = "10.0.2.100"
+	slirpGateway     = "10.0.2.2"
+	slirpDNS         = "10.0.2.3"
+	slirpIPPrefixLen = 24
+)
+
+/**
+ * slirp4netns API 请求
+ */
+type slirpRequest struct {
+	Execute   string                 `json:"execute"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+/**
+ * 启动 slirp4netns 进程并连接容器网络
+ * 1.slirp4netns 进入容器的 user/net namespace 创建 tap 设备并配置地址和路由；
+ * 2.等待 ready-fd 通知网络配置完成；
+ * 3.通过 API socket 配置端口映射；
+ * slirp4netns 进程 pid 记录在容器状态目录下，停止容器时一并结束
+ */
+func ConnectSlirp(paths *container.Paths, info *container.Info) error {
+	stateDir := paths.StateDir(info.Name)
+	if err := os.MkdirAll(stateDir, container.Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.NETWORK), fmt.Sprintf("mkdir state dir %s failed", stateDir), err)
+	}
+	apiSocket := path.Join(stateDir, slirpApiSocket)
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), "create slirp4netns ready pipe failed", err)
+	}
+	defer readyRead.Close()
+	// ExtraFiles[0] 对应 fd 3
+	cmd := exec.Command(SlirpNetworkName, "--configure", "--mtu="+slirpMtu, "--disable-host-loopback",
+		"--ready-fd=3", "--api-socket", apiSocket, info.Pid, slirpTapName)
+	cmd.ExtraFiles = []*os.File{readyWrite}
+	// 脱离当前会话，detach 模式下 mydocker 退出后继续运行
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		readyWrite.Close()
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), "start slirp4netns failed", err)
+	}
+	readyWrite.Close()
+	if err := ioutil.WriteFile(path.Join(stateDir, slirpPidFile), []byte(strconv.Itoa(cmd.Process.Pid)), container.Perm0644); err != nil {
+		log.Errorf("record slirp4netns pid failed %v", err)
+	}
+	ready := make([]byte, 1)
+	if _, err := readyRead.Read(ready); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), "wait for slirp4netns ready failed", err)
+	}
+	// 宿主机 DNS 在容器内不可达，使用 slirp4netns 内置 DNS 转发
+	if err := container.UpdateResolvConf(paths, info.Name, []string{slirpDNS}); err != nil {
+		log.Errorf("update resolv.conf for %s failed %v", info.Name, err)
+	}
+	if err := container.AddHostsEntry(paths, info.Name, slirpGuestIP, info.Hostname, info.Domainname); err != nil {
+		log.Errorf("add hosts entry for %s failed %v", info.Name, err)
+	}
+	for _, pm := range info.PortMapping {
+		if err := addSlirpPortMapping(apiSocket, pm); err != nil {
+			log.Errorf("set portMapping %s for slirp4netns failed %v", pm, err)
+		}
+	}
+	info.NetworkSettings = container.NetworkSettings{
+		Network:     SlirpNetworkName,
+		IPAddress:   slirpGuestIP,
+		IPPrefixLen: slirpIPPrefixLen,
+		Gateway:     slirpGateway,
+		ContainerIf: slirpTapName,
+		Ports:       info.PortMapping,
+	}
+	return nil
+}
+
+/**
+ * 结束容器对应的 slirp4netns 进程
+ */
+func DisconnectSlirp(paths *container.Paths, containerName string) error {
+	pidPath := path.Join(paths.StateDir(containerName), slirpPidFile)
+	content, err := ioutil.ReadFile(pidPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.NETWORK), fmt.Sprintf("read slirp4netns pid %s failed", pidPath), err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.NETWORK), fmt.Sprintf("convert slirp4netns pid %s failed", content), err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("kill slirp4netns %d failed", pid), err)
+	}
+	if err := container.RemoveHostsEntry(paths, containerName, slirpGuestIP); err != nil {
+		log.Errorf("remove hosts entry for %s failed %v", containerName, err)
+	}
+	return os.Remove(pidPath)
+}
+
+/**
+ * 通过 slirp4netns API 添加端口转发
+ * {"execute": "add_hostfwd", "arguments": {"proto": "tcp", "host_addr": "0.0.0.0", "host_port": 8080, "guest_port": 80}}
+ */
+func addSlirpPortMapping(apiSocket, portMapping string) error {
+	mappings := strings.Split(portMapping, ":")
+	if len(mappings) != 2 {
+		return fmt.Errorf("invalid portMapping %s", portMapping)
+	}
+	hostPort, err := strconv.Atoi(mappings[0])
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.NETWORK), fmt.Sprintf("invalid host port %s", mappings[0]), err)
+	}
+	guestPort, err := strconv.Atoi(mappings[1])
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.NETWORK), fmt.Sprintf("invalid container port %s", mappings[1]), err)
+	}
+	conn, err := net.Dial("unix", apiSocket)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.NETWORK), fmt.Sprintf("dial slirp4netns api %s failed", apiSocket), err)
+	}
+	defer conn.Close()
+	req := slirpRequest{
+		Execute: "add_hostfwd",
+		Arguments: map[string]interface{}{
+			"proto":      "tcp",
+			"host_addr":  "0.0.0.0",
+			"host_port":  hostPort,
+			"guest_port": guestPort,
+		},
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.NETWORK), "send slirp4netns request failed", err)
+	}
+	// slirp4netns 在连接半关闭后返回结果
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		unixConn.CloseWrite()
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.NETWORK), "read slirp4netns response failed", err)
+	}
+	if errMsg, ok := resp["error"]; ok {
+		return fmt.Errorf("slirp4netns add_hostfwd failed: %v", errMsg)
+	}
+	return nil
+}
@@ -10,10 +10,41 @@ package nsenter
 #include <stdio.h>
 #include <string.h>
 #include <sys/types.h>
+#include <sys/stat.h>
 #include <sys/wait.h>
 #include <signal.h>
 
+// rootless containers own a user namespace, setns to our own user namespace fails with EINVAL
+static int same_namespace(const char *a, const char *b) {
+    struct stat sa, sb;
+    if (stat(a, &sa) == -1 || stat(b, &sb) == -1) {
+        return 0;
+    }
+    return sa.st_dev == sb.st_dev && sa.st_ino == sb.st_ino;
+}
+
+// join namespaces of other container before go runtime starts, paths are separated by comma
+static void join_namespaces(const char *paths) {
+    char *list = strdup(paths);
+    char *saveptr = NULL;
+    char *nspath;
+    for (nspath = strtok_r(list, ",", &saveptr); nspath; nspath = strtok_r(NULL, ",", &saveptr)) {
+        int fd = open(nspath, O_RDONLY);
+        if (fd == -1 || setns(fd, 0) == -1) {
+            fprintf(stderr, "join namespace %s failed: %s\n", nspath, strerror(errno));
+            exit(1);
+        }
+        close(fd);
+    }
+    free(list);
+}
+
 __attribute__((constructor)) void enter_namespace(void) {
+    char *mydocker_setns = getenv("mydocker_setns");
+    if (mydocker_setns) {
+        join_namespaces(mydocker_setns);
+        return;
+    }
     fprintf(stdout, "Exec Cgo enter_namespace function\n");
     char *mydocker_pid;
     mydocker_pid = getenv("mydocker_pid");
@@ -34,9 +65,13 @@ __attribute__((constructor)) void enter_namespace(void) {
     }
     int i;
     char nspath[1024];
-    char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
-    for (i = 0; i < 5; i++) {
+    // user namespace must be joined first to gain capabilities over the others
+    char *namespaces[] = { "user", "ipc", "uts", "net", "pid", "mnt" };
+    for (i = 0; i < 6; i++) {
         sprintf(nspath, "/proc/%s/ns/%s", mydocker_pid, namespaces[i]);
+        if (i == 0 && same_namespace(nspath, "/proc/self/ns/user")) {
+            continue;
+        }
         int fd = open(nspath, O_RDONLY);
         if (setns(fd, 0) == -1) {
             fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"Mydockker/cgroups"
+	"Mydockker/cgroups/subsystems"
+	"Mydockker/container"
+	"Mydockker/events"
+	"Mydockker/meta"
+	"Mydockker/network"
+	"Mydockker/state"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cgroup of pod, containers of pod are nested under it
+const podCgroupFormat = "mydocker-pod-%s"
+
+// cgroup of infra process under cgroup of pod, cgroup v2 forbids processes in non-leaf cgroup
+const infraCgroupName = "infra"
+
+/**
+ * create pod
+ * 1.start infra process holding net/ipc/uts namespaces and record it as a container;
+ * 2.put infra process into cgroup of pod and set resource limits of pod;
+ * 3.connect infra container to network with port mappings of pod;
+ */
+func CreatePod(podName, nw string, portMapping []string, resConf *subsystems.ResourceConfig, labels map[string]string) error {
+	if container.IsRootless() {
+		return fmt.Errorf("pod is not supported in rootless mode")
+	}
+	if _, err := container.LoadPod(containerPaths(), podName); err == nil {
+		return fmt.Errorf("pod %s already exists", podName)
+	}
+	pod := &container.Pod{
+		Id:             randStringBytes(container.IDLength),
+		Name:           podName,
+		InfraContainer: container.InfraContainerName(podName),
+		Network:        nw,
+		PortMapping:    portMapping,
+		CgroupParent:   fmt.Sprintf(podCgroupFormat, podName),
+		CreateTime:     time.Now().Format("2006-01-02 15:04:05"),
+		Labels:         labels,
+	}
+	if _, err := getContainerInfoByName(pod.InfraContainer); err == nil {
+		return fmt.Errorf("container %s already exists", pod.InfraContainer)
+	}
+	infraCmd, err := container.NewInfraProcess(podName)
+	if err != nil {
+		return err
+	}
+	if err := infraCmd.Start(); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.CONTAINER), "start infra process failed", err)
+	}
+	infraPid := infraCmd.Process.Pid
+	info := &container.Info{
+		Id:         pod.Id,
+		Pid:        strconv.Itoa(infraPid),
+		Command:    "pause",
+		CreateTime: pod.CreateTime,
+		StartedAt:  pod.CreateTime,
+		Name:       pod.InfraContainer,
+		Status:     container.RUNNING,
+		Hostname:   podName,
+		Namespaces: &container.Namespaces{},
+		Pod:        podName,
+		CgroupPath: path.Join(pod.CgroupParent, infraCgroupName),
+	}
+	if info.StartTime, err = container.ProcessStartTime(infraPid); err != nil {
+		log.Warnf("pod::CreatePod read start time of infra process failed %v", err)
+	}
+	if err := createInfraContainer(pod, info, resConf); err != nil {
+		_ = syscall.Kill(infraPid, syscall.SIGTERM)
+		if derr := containerStore().Delete(pod.InfraContainer); derr != nil && !state.IsNotFound(derr) {
+			log.Warnf("pod::CreatePod remove infra container %s failed %v", pod.InfraContainer, derr)
+		} else if derr == nil {
+			eventJournal().LogContainer(events.ActionDestroy, info, nil)
+		}
+		return err
+	}
+	// infra process keeps running after mydocker exits
+	_ = infraCmd.Process.Release()
+	return nil
+}
+
+func createInfraContainer(pod *container.Pod, info *container.Info, resConf *subsystems.ResourceConfig) error {
+	if err := containerStore().Create(info); err != nil {
+		return err
+	}
+	eventJournal().LogContainer(events.ActionCreate, info, nil)
+	eventJournal().LogContainer(events.ActionStart, info, nil)
+	if err := container.CreateEtcFiles(containerPaths(), info.Name, info.Hostname, ""); err != nil {
+		return err
+	}
+	infraPid, _ := strconv.Atoi(info.Pid)
+	if err := cgroups.NewManager(info.CgroupPath).Apply(infraPid, resConf); err != nil {
+		log.Warnf("pod::CreatePod apply cgroup of infra failed %v", err)
+	}
+	if err := cgroups.NewManager(pod.CgroupParent).Set(resConf); err != nil {
+		log.Warnf("pod::CreatePod set cgroup limits of pod failed %v", err)
+	}
+	if pod.Network != "" {
+		initNetwork()
+		info.PortMapping = pod.PortMapping
+		if err := network.Connect(containerPaths(), pod.Network, info); err != nil {
+			return fmt.Errorf("connect pod %s and network %s failed: %v", pod.Name, pod.Network, err)
+		}
+		eventJournal().LogNetwork(events.ActionConnect, pod.Network, info)
+		if err := writeContainerInfo(info); err != nil {
+			return err
+		}
+	}
+	return pod.Dump(containerPaths())
+}
+
+/**
+ * remove pod, containers of pod must be removed first
+ */
+func RemovePod(podName string) error {
+	pod, err := container.LoadPod(containerPaths(), podName)
+	if err != nil {
+		return err
+	}
+	if members := getPodContainers(pod); len(members) > 0 {
+		return fmt.Errorf("pod %s has containers %v, remove them first", podName, members)
+	}
+	// same order as removeContainer: kill and wait for infra process, release network endpoint,
+	// remove cgroups that are empty now, delete the record last
+	info, err := getContainerInfoByName(pod.InfraContainer)
+	if err == nil {
+		if info.Status != container.STOP && info.Status != container.Exit {
+			if info, err = killContainer(info); err != nil {
+				return fmt.Errorf("stop infra container of pod %s failed: %v", podName, err)
+			}
+		}
+		if err := releaseNetworkEndpoint(info); err != nil {
+			log.Warnf("pod::RemovePod release network endpoint of infra failed %v", err)
+		}
+	}
+	if err := cgroups.NewManager(path.Join(pod.CgroupParent, infraCgroupName)).Destory(); err != nil {
+		log.Warnf("pod::RemovePod remove cgroup of infra failed %v", err)
+	}
+	if err := cgroups.NewManager(pod.CgroupParent).Destory(); err != nil {
+		log.Warnf("pod::RemovePod remove cgroup of pod failed %v", err)
+	}
+	if err := containerStore().Delete(pod.InfraContainer); err != nil && !state.IsNotFound(err) {
+		return err
+	} else if err == nil && info != nil {
+		eventJournal().LogContainer(events.ActionDestroy, info, nil)
+	}
+	return pod.Remove(containerPaths())
+}
+
+/**
+ * list pods matching all label filters
+ */
+func ListPods(labelFilters []string) {
+	pods := loadPods()
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	_, err := fmt.Fprint(w, "ID\tNAME\tSTATUS\tINFRA PID\tCONTAINERS\tCREATED\n")
+	if err != nil {
+		log.Errorf("Fprint error %v", err)
+	}
+	for _, pod := range pods {
+		if !matchPodLabels(pod, labelFilters) {
+			continue
+		}
+		status, pid := podStatus(pod)
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			pod.Id,
+			pod.Name,
+			status,
+			pid,
+			len(getPodContainers(pod)),
+			pod.CreateTime)
+		if err != nil {
+			log.Errorf("Fprint error %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Errorf("Flush failed %v", err)
+	}
+}
+
+func matchPodLabels(pod *container.Pod, labelFilters []string) bool {
+	for _, filter := range labelFilters {
+		if !container.MatchLabel(pod.Labels, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * print pod and its containers in json
+ */
+func InspectPod(podName string) error {
+	pod, err := container.LoadPod(containerPaths(), podName)
+	if err != nil {
+		return err
+	}
+	status, pid := podStatus(pod)
+	detail := struct {
+		*container.Pod
+		Status     string   `json:"status"`
+		InfraPid   string   `json:"infraPid"`
+		Containers []string `json:"containers"`
+	}{pod, status, pid, getPodContainers(pod)}
+	content, err := json.MarshalIndent(detail, "", "    ")
+	if err != nil {
+		return meta.NewError(meta.ErrConvert, "marshal pod failed", err)
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+func loadPods() []*container.Pod {
+	files, err := ioutil.ReadDir(containerPaths().PodRoot())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("read pods %s failed %v", containerPaths().PodRoot(), err)
+		}
+		return nil
+	}
+	pods := make([]*container.Pod, 0, len(files))
+	for _, file := range files {
+		pod, err := container.LoadPod(containerPaths(), file.Name())
+		if err != nil {
+			log.Errorf("load pod %s failed %v", file.Name(), err)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+/**
+ * status of pod follows its infra container
+ */
+func podStatus(pod *container.Pod) (string, string) {
+	info, err := getContainerInfoByName(pod.InfraContainer)
+	if err != nil {
+		return container.Exit, ""
+	}
+	return info.Status, info.Pid
+}
+
+/**
+ * containers of pod except infra container
+ */
+func getPodContainers(pod *container.Pod) []string {
+	var members []string
+	for _, info := range loadContainerInfos() {
+		if info.Pod != pod.Name || info.Name == pod.InfraContainer {
+			continue
+		}
+		members = append(members, info.Name)
+	}
+	return members
+}
@@ -4,142 +4,487 @@ import (
 	"Mydockker/cgroups"
 	"Mydockker/cgroups/subsystems"
 	"Mydockker/container"
+	"Mydockker/events"
 	"Mydockker/meta"
 	"Mydockker/network"
+	"Mydockker/seccomp"
+	"Mydockker/state"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
+	"os/exec"
+	"path"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 /**
  * clone process which dividing by namespace, using /proc/self/exe to init processResource
+ * every step registers its undo action, any failure rolls back all steps done so far:
+ * containerInfo and etc files, workspace and logger, cgroup, init process, network endpoint
+ * container name is reserved by recording containerInfo in created status before anything else
  * attention:
  * 1.only after childProcess has been inilizated that we can write message to writePipe by parentProcess
  */
-func Run(tty bool, cmdArray []string, resConf *subsystems.ResourceConfig, volume string, containerName, imageName string,
-	envSlice []string, nw string, portMapping []string) {
+func Run(tty bool, initConf *container.InitConfig, resConf *subsystems.ResourceConfig, volume string, containerName, imageName string,
+	envSlice []string, nw string, portMapping []string, seccompOpt string, namespaces *container.Namespaces, pod *container.Pod, labels map[string]string, logConfig *container.LogConfig) (err error) {
 	// create containerId if containerName is null
 	containerID := randStringBytes(container.IDLength)
 	if containerName == "" {
 		containerName = containerID
 	}
+	// status pipe of the monitor is not inherited by init, logger or slirp4netns
+	if os.Getenv(EnvMonitor) != "" {
+		syscall.CloseOnExec(3)
+	}
+	tx := &transaction{}
+	defer func() {
+		if err != nil {
+			log.Warnf("run::Run container %s failed, rolling back", containerName)
+			tx.rollback()
+		}
+	}()
+	// resolve containers whose namespaces will be joined
+	if err := namespaces.Resolve(getRunningContainerPid); err != nil {
+		return err
+	}
+	// hostname defaults to containerId, only set in private uts namespace
+	if container.IsPrivateNamespace(namespaces.Uts) && initConf.Hostname == "" {
+		initConf.Hostname = containerID
+	}
+	// containers of pod are nested under cgroup of pod
+	cgroupPath := meta.CGROUP_PATH
+	if pod != nil {
+		cgroupPath = path.Join(pod.CgroupParent, containerName)
+	}
+	// record containerInfo, fails if container name is in use
+	info, err := recordContainerInfo(initConf, resConf, containerName, containerID, imageName, volume, seccompOpt, cgroupPath, namespaces, pod, labels, logConfig)
+	if err != nil {
+		return err
+	}
+	// state directory also holds etc files and slirp4netns pid
+	eventJournal().LogContainer(events.ActionCreate, info, nil)
+	tx.onRollback("delete containerInfo", func() error {
+		if err := containerStore().Delete(containerName); err != nil {
+			return err
+		}
+		eventJournal().LogContainer(events.ActionDestroy, info, nil)
+		return nil
+	})
 	// get writePipe and initCmd of parentProcess
-	cmdProcess, writePipe := container.NewParentProcess(tty, volume, containerName, imageName, envSlice)
-	if cmdProcess == nil {
-		log.Errorf("run::Run create child process failed")
-		return
+	cmdProcess, writePipe, loggerProcess, err := container.NewParentProcess(containerPaths(), tty, volume, containerID, containerName, imageName, envSlice, namespaces, logConfig, info.Mounts)
+	if err != nil {
+		return err
 	}
+	tx.onRollback("delete workspace", func() error {
+		writePipe.Close()
+		if loggerProcess != nil {
+			// logger is stopped before its log directory is removed
+			loggerProcess.Stop()
+			os.RemoveAll(containerPaths().LogDir(containerName))
+		}
+		return container.DeleteWorkSpace(containerPaths(), volume, containerName)
+	})
+	// registered before the init process starts so that it's undone after the process is killed,
+	// a cgroup can't be removed while any process is still in it
+	tx.onRollback("destroy cgroup", func() error {
+		if cgroupInUse(info) {
+			return nil
+		}
+		return cgroups.NewManager(cgroupPath).Destory()
+	})
 	// create childProcess to init container
-	if err := cmdProcess.Start(); err != nil {
-		log.Errorf("run::Run parent Start failed %v", err)
-		return
+	if err := container.StartParentProcess(cmdProcess, namespaces); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.CONTAINER), "start init process failed", err)
 	}
-	// record containerInfo
-	if err := recordContainerInfo(cmdProcess.Process.Pid, cmdArray, containerName, containerID, volume); err != nil {
-		log.Errorf("record containerInfo failed %v", err)
-		return
+	tx.onRollback("kill init process", func() error {
+		// tty container has exited and been waited
+		if cmdProcess.ProcessState != nil {
+			return nil
+		}
+		cmdProcess.Process.Kill()
+		cmdProcess.Wait()
+		return nil
+	})
+	// rootless: map current user to root of container's user namespace
+	if container.IsRootless() {
+		if err := container.SetupUserNamespace(cmdProcess.Process.Pid); err != nil {
+			return err
+		}
+	}
+	info.Pid = strconv.Itoa(cmdProcess.Process.Pid)
+	info.Status = container.RUNNING
+	info.StartedAt = time.Now().Format(timeLayout)
+	// this process waits for init process and records its exit
+	info.MonitorPid = os.Getpid()
+	if info.MonitorStart, err = container.ProcessStartTime(info.MonitorPid); err != nil {
+		return err
+	}
+	// start time tells the init process apart from a later process reusing its pid
+	if info.StartTime, err = container.ProcessStartTime(cmdProcess.Process.Pid); err != nil {
+		return err
 	}
+	if err := writeContainerInfo(info); err != nil {
+		return err
+	}
+	eventJournal().LogContainer(events.ActionStart, info, nil)
+	// generate /etc/hostname、/etc/hosts、/etc/resolv.conf for container
+	if err := container.CreateEtcFiles(containerPaths(), containerName, initConf.Hostname, initConf.Domainname); err != nil {
+		return err
+	}
+	setupSharedNamespaceFiles(initConf, containerName, namespaces)
 	// set resourceControl for container
-	cgroupManager := cgroups.NewCgroupManger(meta.CGROUP_PATH)
-	defer cgroupManager.Destory()
-	cgroupManager.Set(resConf)
-	cgroupManager.Apply(cmdProcess.Process.Pid, resConf)
+	cgroupManager := cgroups.NewManager(cgroupPath)
+	if err := cgroupManager.Set(resConf); err != nil {
+		log.Warnf("run::Run set cgroup limits failed %v", err)
+	}
+	if err := cgroupManager.Apply(cmdProcess.Process.Pid, resConf); err != nil {
+		log.Warnf("run::Run apply cgroup limits failed %v", err)
+	}
+	// oom kills counted before start tell whether the container is killed by oom killer
+	oomKills, oomErr := cgroups.OOMKillCount(cgroupPath)
 
 	// set network-config for container
 	if nw != "" {
-		// init system-network
-		network.Init()
-		containerInfo := &container.Info{
-			Id:          containerID,
-			Name:        containerName,
-			Pid:         strconv.Itoa(cmdProcess.Process.Pid),
-			PortMapping: portMapping,
-		}
-		if err := network.Connect(nw, containerInfo); err != nil {
-			log.Errorf("connect container %s and network %s failed: %v", containerName, nw, err)
-			return
+		if err := connectNetwork(tx, nw, info, portMapping); err != nil {
+			return err
 		}
 	}
 
 	// send parameters to childProcess after childProcess has been inilizated
-	sendInitCommands(cmdArray, writePipe)
+	if err := sendInitConfig(initConf, writePipe); err != nil {
+		return err
+	}
 	if tty {
 		_ = cmdProcess.Wait()
-		container.DeleteWorkSpace(volume, containerName)
-		deleteContainerInfo(containerName)
+		exitCode, oomKilled := exitStatus(cmdProcess.ProcessState, cgroupPath, oomKills, oomErr)
+		logContainerExit(info, exitCode, oomKilled)
+		// container is removed on exit, undo every step
+		tx.rollback()
+		return nil
 	}
+	// detached: mydocker run returns now, this process keeps waiting for init process as its monitor
+	notifyMonitorStarted()
+	_ = cmdProcess.Wait()
+	exitCode, oomKilled := exitStatus(cmdProcess.ProcessState, cgroupPath, oomKills, oomErr)
+	recordContainerExit(info, exitCode, oomKilled)
+	return nil
 }
 
+// set in the monitor process started by mydocker run -d, fd 3 is the pipe reporting that the container is started
+const EnvMonitor = "mydocker_monitor"
+
 /**
- * record containerInfo
- * 1）containerPid：容器进程ID；
- * 2）commandArray：容器命令行参数；
+ * start mydocker run -d again as monitor of the container and return once the container is started
+ * the monitor is the parent of init process, only it can wait for the exit code and check oom kills
+ * it runs in its own session so that closing the terminal doesn't kill it, errors are reported by itself
+ */
+func startMonitor() error {
+	exePath, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.CONTAINER), "can't find /proc/self/exe link", err)
+	}
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "create monitor pipe failed", err)
+	}
+	defer readPipe.Close()
+	monitorCmd := exec.Command(exePath, os.Args[1:]...)
+	monitorCmd.Stdout = os.Stdout
+	monitorCmd.Stderr = os.Stderr
+	monitorCmd.ExtraFiles = []*os.File{writePipe}
+	monitorCmd.Env = append(os.Environ(), EnvMonitor+"=1")
+	monitorCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = monitorCmd.Start()
+	writePipe.Close()
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrDriverExec, meta.CONTAINER), "start monitor failed", err)
+	}
+	// one byte once started, EOF if the monitor exits on failure
+	if n, _ := readPipe.Read(make([]byte, 1)); n == 1 {
+		return monitorCmd.Process.Release()
+	}
+	_ = monitorCmd.Wait()
+	return cli.NewExitError("", monitorCmd.ProcessState.ExitCode())
+}
+
+/**
+ * tell mydocker run that the container is started, then discard output of the monitor
+ * so that it never writes to the terminal or pipe of mydocker run after it returns
+ */
+func notifyMonitorStarted() {
+	if os.Getenv(EnvMonitor) == "" {
+		return
+	}
+	status := os.NewFile(3, "monitor")
+	if _, err := status.Write([]byte{0}); err != nil {
+		log.Warnf("run::notifyMonitorStarted notify mydocker run failed %v", err)
+	}
+	status.Close()
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	defer devNull.Close()
+	unix.Dup3(int(devNull.Fd()), 1, 0)
+	unix.Dup3(int(devNull.Fd()), 2, 0)
+}
+
+/**
+ * connect container to network and record its endpoint, undo is registered once connected
+ * network.Connect releases its own partial work on failure
+ */
+func connectNetwork(tx *transaction, nw string, info *container.Info, portMapping []string) error {
+	info.PortMapping = portMapping
+	// rootless: bridge network needs root, use userspace network stack
+	if container.IsRootless() {
+		if nw != network.SlirpNetworkName {
+			return meta.NewError(meta.NewErrorCode(meta.ErrInvalidParam, meta.NETWORK), fmt.Sprintf("rootless mode only supports %s network, got %s", network.SlirpNetworkName, nw), nil)
+		}
+		// slirp4netns may be started before a later failure of ConnectSlirp
+		tx.onRollback("disconnect slirp4netns", func() error {
+			return network.DisconnectSlirp(containerPaths(), info.Name)
+		})
+		if err := network.ConnectSlirp(containerPaths(), info); err != nil {
+			return err
+		}
+	} else {
+		// init system-network
+		if err := initNetwork(); err != nil {
+			return err
+		}
+		if err := network.Connect(containerPaths(), nw, info); err != nil {
+			return err
+		}
+		tx.onRollback("disconnect network", func() error {
+			if err := network.Disconnect(containerPaths(), info); err != nil {
+				return err
+			}
+			eventJournal().LogNetwork(events.ActionDisconnect, nw, info)
+			return nil
+		})
+	}
+	eventJournal().LogNetwork(events.ActionConnect, nw, info)
+	// record network endpoint of container
+	return writeContainerInfo(info)
+}
+
+/**
+ * exit code of init process, 128 + signal when killed by a signal
+ * a container killed by SIGKILL while oom kills of its cgroup increased is oom killed
+ */
+func exitStatus(processState *os.ProcessState, cgroupPath string, oomKills int, oomErr error) (int, bool) {
+	exitCode := processState.ExitCode()
+	oomKilled := false
+	if status, ok := processState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exitCode = 128 + int(status.Signal())
+		if status.Signal() == syscall.SIGKILL && oomErr == nil {
+			if count, err := cgroups.OOMKillCount(cgroupPath); err == nil && count > oomKills {
+				oomKilled = true
+			}
+		}
+	}
+	return exitCode, oomKilled
+}
+
+/**
+ * record die event with exit code, an oom killed container is reported oom before die
+ */
+func logContainerExit(info *container.Info, exitCode int, oomKilled bool) {
+	if oomKilled {
+		eventJournal().LogContainer(events.ActionOOM, info, nil)
+	}
+	eventJournal().LogContainer(events.ActionDie, info, map[string]string{"exitCode": strconv.Itoa(exitCode)})
+}
+
+/**
+ * monitor records exit code of a detached container and releases its network endpoint
+ * nothing is recorded if the container has been removed or its exit has been recorded
+ */
+func recordContainerExit(info *container.Info, exitCode int, oomKilled bool) {
+	exited, err := state.Modify(containerStore(), info.Name, func(current *container.Info) error {
+		if current.Status != container.RUNNING || current.Pid != info.Pid {
+			return errNotRunning
+		}
+		current.Status = container.Exit
+		current.Pid = " "
+		current.ExitCode = exitCode
+		current.OOMKilled = oomKilled
+		current.FinishedAt = time.Now().Format(timeLayout)
+		return nil
+	})
+	if err != nil {
+		if err != errNotRunning && !state.IsNotFound(err) {
+			log.Warnf("run::recordContainerExit record exit of %s failed %v", info.Name, err)
+		}
+		return
+	}
+	logContainerExit(exited, exitCode, oomKilled)
+	if err := releaseNetworkEndpoint(exited); err != nil {
+		log.Warnf("run::recordContainerExit release network endpoint of %s failed %v", info.Name, err)
+	}
+}
+
+/**
+ * choose /etc files and /dev/shm according to namespace modes
+ * 1.private uts namespace owns /etc/hostname；
+ * 2.container sharing network namespace uses /etc/hosts、/etc/resolv.conf of that container；
+ * 3.container sharing ipc namespace uses /dev/shm of host or that container；
+ */
+func setupSharedNamespaceFiles(initConf *container.InitConfig, containerName string, namespaces *container.Namespaces) {
+	if container.IsPrivateNamespace(namespaces.Uts) {
+		initConf.HostnamePath = containerPaths().HostnamePath(containerName)
+	}
+	etcOwner := containerName
+	if target, ok := container.NamespaceContainer(namespaces.Net); ok {
+		etcOwner = target
+	}
+	initConf.HostsPath = containerPaths().HostsPath(etcOwner)
+	initConf.ResolvConfPath = containerPaths().ResolvConfPath(etcOwner)
+	if namespaces.Ipc == container.NamespaceModeHost {
+		initConf.ShmPath = "/dev/shm"
+	} else if pid := namespaces.JoinPid("ipc"); pid != "" {
+		initConf.ShmPath = fmt.Sprintf("/proc/%s/root/dev/shm", pid)
+	}
+}
+
+/**
+ * get name and pid of running container, used to join its namespaces
+ */
+func getRunningContainerPid(containerRef string) (string, string, error) {
+	info, err := resolveContainer(containerRef)
+	if err != nil {
+		return "", "", err
+	}
+	if info.Status != container.RUNNING {
+		return "", "", fmt.Errorf("container %s is not running", info.Name)
+	}
+	return info.Name, info.Pid, nil
+}
+
+/**
+ * record containerInfo in created status, pid is recorded after init process starts
+ * 1）initConf：容器命令行参数、capability 集合；
+ * 2）resConf：cgroup 资源限制；
  * 3）containerName：容器名；
  * 4）containerId：容器ID；
- * 5）volume：容器挂载目录；
+ * 5）imageName：容器镜像；
+ * 6）volume：容器挂载目录；
+ * 7）seccompOpt：seccomp 配置；
+ * 8）cgroupPath：容器 cgroup 路径；
+ * 9）namespaces：namespace 共享模式；
+ * 10）pod：所属 pod，可以为空；
+ * 11）labels：容器标签；
+ * 12）logConfig：容器日志配置；
  */
-func recordContainerInfo(containerPid int, commandArray []string, containerName, containerId, volume string) error {
+func recordContainerInfo(initConf *container.InitConfig, resConf *subsystems.ResourceConfig, containerName, containerId, imageName,
+	volume, seccompOpt, cgroupPath string, namespaces *container.Namespaces, pod *container.Pod, labels map[string]string, logConfig *container.LogConfig) (*container.Info, error) {
 	createTime := time.Now().Format("2006-01-02 15:04:05")
-	command := strings.Join(commandArray, "")
-	info := container.Info{
-		Id:         containerId,
-		Pid:        strconv.Itoa(containerPid),
-		Command:    command,
-		CreateTime: createTime,
-		Name:       containerName,
-		Status:     container.RUNNING,
-		Volume:     volume,
-	}
-	jsonBytes, err := json.Marshal(info)
-	if err != nil {
-		log.Errorf("Record containerInfo is empty")
-		return meta.NewError(meta.ErrWrite, "Record containerInfo is empty", err)
-	}
-	jsonStr := string(jsonBytes)
-	// save containerInfo into local-file
-	dirUrl := fmt.Sprintf(container.JsonFormat, containerName)
-	if err := os.MkdirAll(dirUrl, container.Perm0622); err != nil {
-		log.Errorf("Mkdir %s failed %v", dirUrl, err)
-		return meta.NewError(meta.ErrWrite, "create containerInfo directory failed", err)
-	}
-	fileName := dirUrl + container.ConfigName
-	file, err := os.Create(fileName)
-	defer file.Close()
+	command := strings.Join(initConf.Args, "")
+	info := &container.Info{
+		Id:           containerId,
+		Command:      command,
+		CreateTime:   createTime,
+		Name:         containerName,
+		Status:       container.CREATED,
+		Volume:       volume,
+		Capabilities: initConf.Capabilities,
+		Privileged:   initConf.Privileged,
+		Seccomp:      seccompOpt,
+		ReadOnly:     initConf.ReadOnly,
+		Tmpfs:        initConf.Tmpfs,
+		Hostname:     initConf.Hostname,
+		Domainname:   initConf.Domainname,
+		Rlimits:      initConf.Rlimits,
+		OomScoreAdj:  initConf.OomScoreAdj,
+		Sysctls:      initConf.Sysctls,
+		CgroupNS:     initConf.CgroupNS,
+		TimeOffsets:  initConf.TimeOffsets,
+		Namespaces:   namespaces,
+		Image:        imageName,
+		Resources: &container.Resources{
+			MemoryLimit: resConf.MemoryLimit,
+			CpuCfsQuota: resConf.CpuCfsQuota,
+			CpuShare:    resConf.CpuShare,
+			CpuSet:      resConf.CpuSet,
+		},
+		CgroupPath: cgroupPath,
+		Mounts:     container.ContainerMounts(volume, initConf.Tmpfs),
+		Labels:     labels,
+		LogConfig:  *logConfig,
+	}
+	if pod != nil {
+		info.Pod = pod.Name
+	}
+	if err := containerStore().Create(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+/**
+ * save containerInfo, fails if it was modified since info was read
+ */
+func writeContainerInfo(info *container.Info) error {
+	return containerStore().Update(info)
+}
+
+/**
+ *  send initConfig to childProcess by pipe
+ */
+func sendInitConfig(initConf *container.InitConfig, writePipe *os.File) error {
+	defer writePipe.Close()
+	log.Infof("run::sendInitConfig all commands:%v", strings.Join(initConf.Args, " "))
+	content, err := json.Marshal(initConf)
 	if err != nil {
-		log.Errorf("Create file %s failed %v", fileName, err)
-		return meta.NewError(meta.ErrWrite, "create containerInfo-file failed", err)
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.CONTAINER), "marshal initConfig failed", err)
 	}
-	if _, err := file.WriteString(jsonStr); err != nil {
-		log.Errorf("Write containerInfo into file failed %v", err)
-		return meta.NewError(meta.ErrWrite, "write container-info into file failed", err)
+	if _, err := writePipe.Write(content); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.CONTAINER), "write initConfig into pipe failed", err)
 	}
-	return err
+	return nil
 }
 
 /**
- * delete containerInfo
+ * parse --security-opt, only seccomp=xxx is supported
+ * privileged container runs without seccomp
+ * the implicit default profile falls back to unconfined on architectures without syscall table,
+ * an explicit profile fails there when compiled
  */
-func deleteContainerInfo(containerName string) {
-	url := fmt.Sprintf(container.JsonFormat, containerName)
-	if err := os.RemoveAll(url); err != nil {
-		log.Errorf("Remove containerInfo %v failed %v", url, err)
+func parseSecurityOpts(opts []string, privileged bool) (string, error) {
+	seccompOpt := seccomp.DefaultProfileName
+	if privileged {
+		seccompOpt = seccomp.Unconfined
+	} else if len(opts) == 0 && !seccomp.Supported() {
+		log.Warnf("seccomp is not supported on this architecture, running container unconfined")
+		seccompOpt = seccomp.Unconfined
+	}
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] != "seccomp" {
+			return "", fmt.Errorf("unsupported security option %s", opt)
+		}
+		seccompOpt = kv[1]
 	}
+	return seccompOpt, nil
 }
 
 /**
- *  send parameters to childProcess by pipe
+ * compile seccomp profile to BPF, unconfined returns nil
  */
-func sendInitCommands(commandArray []string, writePipe *os.File) {
-	command := strings.Join(commandArray, " ")
-	log.Infof("run::sendInitCommands all commands:%v", command)
-	writePipe.WriteString(command)
-	writePipe.Close()
+func compileSeccomp(seccompOpt string, caps []string) ([]unix.SockFilter, error) {
+	profile, err := seccomp.GetProfile(seccompOpt)
+	if err != nil || profile == nil {
+		return nil, err
+	}
+	return seccomp.Compile(profile, caps)
 }
 
 /**
@@ -0,0 +1,310 @@
+package seccomp
+
+import (
+	"Mydockker/meta"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 将 seccomp 配置编译为 classic BPF 程序
+ * 程序结构：
+ * 1.校验 seccomp_data.arch，非本机架构直接结束进程；
+ * 2.加载 seccomp_data.nr，按规则顺序逐条比较，首条匹配的规则决定动作；
+ * 3.带参数条件的规则依次比较参数，不满足时跳转到下一条规则；
+ * 4.全部不匹配时返回 defaultAction；
+ */
+
+// struct seccomp_data 字段偏移
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+)
+
+// seccomp 返回值
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+	retDataMask    = 0x0000ffff
+)
+
+const (
+	// x32 ABI 的 syscall 编号带有该标志位
+	x32SyscallBit = 0x40000000
+	// 内核允许的最大指令数
+	maxInstructions = 4096
+	// jt/jf 为 8 位偏移
+	maxJump = 255
+)
+
+/**
+ * 带符号跳转目标的 BPF 指令，空 label 表示顺序执行下一条指令
+ */
+type instruction struct {
+	code uint16
+	k    uint32
+	jt   string
+	jf   string
+}
+
+/**
+ * BPF 汇编器，label 在下一条指令生成时绑定
+ */
+type assembler struct {
+	insns   []instruction
+	labels  map[string]int
+	pending []string
+	counter int
+}
+
+func newAssembler() *assembler {
+	return &assembler{labels: map[string]int{}}
+}
+
+func (a *assembler) newLabel() string {
+	a.counter++
+	return fmt.Sprintf("L%d", a.counter)
+}
+
+func (a *assembler) bind(label string) {
+	a.pending = append(a.pending, label)
+}
+
+func (a *assembler) emit(code uint16, k uint32, jt, jf string) {
+	for _, label := range a.pending {
+		a.labels[label] = len(a.insns)
+	}
+	a.pending = nil
+	a.insns = append(a.insns, instruction{code: code, k: k, jt: jt, jf: jf})
+}
+
+func (a *assembler) load(offset uint32) {
+	a.emit(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offset, "", "")
+}
+
+func (a *assembler) ret(k uint32) {
+	a.emit(unix.BPF_RET|unix.BPF_K, k, "", "")
+}
+
+func (a *assembler) jump(op uint16, k uint32, jt, jf string) {
+	a.emit(unix.BPF_JMP|op|unix.BPF_K, k, jt, jf)
+}
+
+/**
+ * 将符号跳转解析为相对偏移
+ */
+func (a *assembler) assemble() ([]unix.SockFilter, error) {
+	if len(a.insns) > maxInstructions {
+		return nil, meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("seccomp filter too large: %d instructions", len(a.insns)), nil)
+	}
+	filter := make([]unix.SockFilter, len(a.insns))
+	for i, insn := range a.insns {
+		jt, err := a.offset(i, insn.jt)
+		if err != nil {
+			return nil, err
+		}
+		jf, err := a.offset(i, insn.jf)
+		if err != nil {
+			return nil, err
+		}
+		filter[i] = unix.SockFilter{Code: insn.code, Jt: jt, Jf: jf, K: insn.k}
+	}
+	return filter, nil
+}
+
+func (a *assembler) offset(current int, label string) (uint8, error) {
+	if label == "" {
+		return 0, nil
+	}
+	target, ok := a.labels[label]
+	if !ok {
+		return 0, meta.NewError(meta.ErrNotFound, fmt.Sprintf("seccomp label %s not bound", label), nil)
+	}
+	distance := target - current - 1
+	if distance < 0 || distance > maxJump {
+		return 0, meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("seccomp jump %d out of range", distance), nil)
+	}
+	return uint8(distance), nil
+}
+
+/**
+ * 当前架构是否有 syscall 编号表，没有时只能 unconfined
+ */
+func Supported() bool {
+	return nativeArch != ""
+}
+
+/**
+ * 编译 seccomp 配置，caps 为容器 capability 集合，用于计算 includes/excludes
+ */
+func Compile(profile *Profile, caps []string) ([]unix.SockFilter, error) {
+	if nativeArch == "" {
+		return nil, meta.NewError(meta.ErrUnsupportedType, "seccomp is not supported on this architecture", nil)
+	}
+	defaultAction, err := actionValue(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+	capSet := map[string]bool{}
+	for _, c := range caps {
+		capSet[c] = true
+	}
+	a := newAssembler()
+	// 1.校验架构，x32 ABI 同样视为非本机架构
+	archOk := a.newLabel()
+	a.load(offsetArch)
+	a.jump(unix.BPF_JEQ, nativeAuditArch, archOk, "")
+	a.ret(retKillProcess)
+	a.bind(archOk)
+	a.load(offsetNr)
+	if nativeAuditArch == unix.AUDIT_ARCH_X86_64 {
+		nrOk := a.newLabel()
+		a.jump(unix.BPF_JGE, x32SyscallBit, "", nrOk)
+		a.ret(retKillProcess)
+		a.bind(nrOk)
+	}
+	// 2.逐条比较规则
+	for _, rule := range profile.Syscalls {
+		if !rule.enabled(capSet) {
+			continue
+		}
+		action, err := actionValue(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rule.names() {
+			nr, ok := syscallTable[name]
+			if !ok {
+				// 当前架构不存在的 syscall 直接忽略
+				continue
+			}
+			if err := compileRule(a, nr, rule.Args, action); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// 3.默认动作
+	a.ret(defaultAction)
+	return a.assemble()
+}
+
+/**
+ * 编译单条规则，进入规则时累加器中为 syscall 编号
+ * 带参数条件时会覆盖累加器，因此在规则结束处重新加载 syscall 编号
+ */
+func compileRule(a *assembler, nr uint32, args []*Arg, action uint32) error {
+	next := a.newLabel()
+	if len(args) == 0 {
+		a.jump(unix.BPF_JEQ, nr, "", next)
+		a.ret(action)
+		a.bind(next)
+		return nil
+	}
+	reload := a.newLabel()
+	a.jump(unix.BPF_JEQ, nr, "", next)
+	for _, arg := range args {
+		if err := compileArg(a, arg, reload); err != nil {
+			return err
+		}
+	}
+	a.ret(action)
+	a.bind(reload)
+	a.load(offsetNr)
+	a.bind(next)
+	return nil
+}
+
+/**
+ * 编译 64 位参数比较，参数按小端序存放，高 32 位在低 32 位之后
+ * 条件满足时顺序执行，不满足时跳转到 fail
+ */
+func compileArg(a *assembler, arg *Arg, fail string) error {
+	if arg.Index > 5 {
+		return meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("invalid seccomp arg index %d", arg.Index), nil)
+	}
+	low := offsetArgs + 8*uint32(arg.Index)
+	high := low + 4
+	value := arg.Value
+	vHigh, vLow := uint32(value>>32), uint32(value)
+	pass := a.newLabel()
+	switch arg.Op {
+	case OpEqualTo:
+		a.load(high)
+		a.jump(unix.BPF_JEQ, vHigh, "", fail)
+		a.load(low)
+		a.jump(unix.BPF_JEQ, vLow, "", fail)
+	case OpNotEqual:
+		a.load(high)
+		a.jump(unix.BPF_JEQ, vHigh, "", pass)
+		a.load(low)
+		a.jump(unix.BPF_JEQ, vLow, fail, "")
+	case OpMaskedEqual:
+		// value 为掩码，valueTwo 为期望值
+		a.load(high)
+		a.emit(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, vHigh, "", "")
+		a.jump(unix.BPF_JEQ, uint32(arg.ValueTwo>>32), "", fail)
+		a.load(low)
+		a.emit(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, vLow, "", "")
+		a.jump(unix.BPF_JEQ, uint32(arg.ValueTwo), "", fail)
+	case OpGreaterThan, OpGreaterEqual:
+		op := uint16(unix.BPF_JGT)
+		if arg.Op == OpGreaterEqual {
+			op = unix.BPF_JGE
+		}
+		a.load(high)
+		a.jump(unix.BPF_JGT, vHigh, pass, "")
+		a.jump(unix.BPF_JEQ, vHigh, "", fail)
+		a.load(low)
+		a.jump(op, vLow, "", fail)
+	case OpLessThan, OpLessEqual:
+		// arg < value 等价于 !(arg >= value)
+		op := uint16(unix.BPF_JGE)
+		if arg.Op == OpLessEqual {
+			op = unix.BPF_JGT
+		}
+		a.load(high)
+		a.jump(unix.BPF_JGT, vHigh, fail, "")
+		a.jump(unix.BPF_JEQ, vHigh, "", pass)
+		a.load(low)
+		a.jump(op, vLow, fail, "")
+	default:
+		return meta.NewError(meta.ErrUnsupportedType, fmt.Sprintf("unsupported seccomp operator %s", arg.Op), nil)
+	}
+	a.bind(pass)
+	return nil
+}
+
+/**
+ * 将 seccomp 动作转换为 BPF 返回值，ERRNO 默认返回 EPERM
+ */
+func actionValue(action string, errnoRet *uint) (uint32, error) {
+	data := uint32(unix.EPERM)
+	if errnoRet != nil {
+		data = uint32(*errnoRet) & retDataMask
+	}
+	switch action {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | data, nil
+	case ActTrace:
+		return retTrace | data, nil
+	case ActAllow:
+		return retAllow, nil
+	case ActLog:
+		return retLog, nil
+	default:
+		return 0, meta.NewError(meta.ErrUnsupportedType, fmt.Sprintf("unsupported seccomp action %s", action), nil)
+	}
+}
@@ -0,0 +1,133 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 解释执行 BPF 程序，模拟内核对 seccomp_data 的过滤
+ */
+func evaluate(t *testing.T, filter []unix.SockFilter, name string, args ...uint64) uint32 {
+	nr, ok := syscallTable[name]
+	if !ok {
+		t.Fatalf("unknown syscall %s", name)
+	}
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[offsetNr:], nr)
+	binary.LittleEndian.PutUint32(data[offsetArch:], nativeAuditArch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		insn := filter[pc]
+		switch insn.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[insn.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= insn.K
+		case unix.BPF_RET | unix.BPF_K:
+			return insn.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var cond bool
+			switch insn.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				cond = acc == insn.K
+			case unix.BPF_JGT:
+				cond = acc > insn.K
+			case unix.BPF_JGE:
+				cond = acc >= insn.K
+			}
+			if cond {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		default:
+			t.Fatalf("unexpected instruction %#x", insn.Code)
+		}
+	}
+	t.Fatal("filter has no return")
+	return 0
+}
+
+func TestDefaultProfile(t *testing.T) {
+	if nativeArch == "" {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+	filter, err := Compile(DefaultProfile(), []string{"CAP_CHOWN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eperm := uint32(retErrno | unix.EPERM)
+	cases := []struct {
+		name   string
+		args   []uint64
+		expect uint32
+	}{
+		{"read", nil, retAllow},
+		{"mount", nil, eperm},
+		{"personality", []uint64{0x8}, retAllow},
+		{"personality", []uint64{0x1}, eperm},
+		{"socket", []uint64{unix.AF_INET}, retAllow},
+		{"socket", []uint64{afVsock}, eperm},
+		{"clone", []uint64{uint64(unix.SIGCHLD)}, retAllow},
+		{"clone", []uint64{unix.CLONE_NEWNS | uint64(unix.SIGCHLD)}, eperm},
+		{"clone3", nil, retErrno | errnoENOSYS},
+	}
+	for _, c := range cases {
+		if got := evaluate(t, filter, c.name, c.args...); got != c.expect {
+			t.Errorf("%s%v: expect %#x got %#x", c.name, c.args, c.expect, got)
+		}
+	}
+	filter, err = Compile(DefaultProfile(), []string{"CAP_SYS_ADMIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := evaluate(t, filter, "mount"); got != retAllow {
+		t.Errorf("mount with CAP_SYS_ADMIN: got %#x", got)
+	}
+	if got := evaluate(t, filter, "clone", unix.CLONE_NEWNS); got != retAllow {
+		t.Errorf("clone with CAP_SYS_ADMIN: got %#x", got)
+	}
+}
+
+func TestCompareOperators(t *testing.T) {
+	if nativeArch == "" {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+	rule := func(op string, value uint64) *Profile {
+		return &Profile{
+			DefaultAction: ActKillProcess,
+			Syscalls:      []*Syscall{{Names: []string{"write"}, Action: ActAllow, Args: []*Arg{{Index: 2, Value: value, Op: op}}}},
+		}
+	}
+	cases := []struct {
+		op     string
+		value  uint64
+		arg    uint64
+		expect bool
+	}{
+		{OpLessThan, 1 << 33, 1<<33 - 1, true},
+		{OpLessThan, 1 << 33, 1 << 33, false},
+		{OpLessEqual, 1 << 33, 1 << 33, true},
+		{OpGreaterThan, 100, 1 << 32, true},
+		{OpGreaterThan, 100, 100, false},
+		{OpGreaterEqual, 100, 100, true},
+		{OpNotEqual, 1 << 40, 1 << 40, false},
+		{OpNotEqual, 1 << 40, 1, true},
+	}
+	for _, c := range cases {
+		filter, err := Compile(rule(c.op, c.value), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := evaluate(t, filter, "write", 0, 0, c.arg) == retAllow
+		if got != c.expect {
+			t.Errorf("%s %d with arg %d: expect %v", c.op, c.value, c.arg, c.expect)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package seccomp
+
+import "sort"
+
+/**
+ * 内置默认 seccomp 配置，参考 docker 默认配置 profiles/seccomp/default.json
+ * 1.默认返回 EPERM；
+ * 2.放行常用 syscall；
+ * 3.mount、unshare、reboot 等危险 syscall 仅在拥有对应 capability 时放行；
+ */
+
+// 无条件放行的 syscall
+var defaultAllowedSyscalls = []string{
+	"accept", "accept4", "access", "adjtimex", "alarm", "bind", "brk", "cachestat", "capget", "capset",
+	"chdir", "chmod", "chown", "chown32", "clock_adjtime", "clock_adjtime64", "clock_getres",
+	"clock_getres_time64", "clock_gettime", "clock_gettime64", "clock_nanosleep", "clock_nanosleep_time64",
+	"close", "close_range", "connect", "copy_file_range", "creat", "dup", "dup2", "dup3", "epoll_create",
+	"epoll_create1", "epoll_ctl", "epoll_ctl_old", "epoll_pwait", "epoll_pwait2", "epoll_wait",
+	"epoll_wait_old", "eventfd", "eventfd2", "execve", "execveat", "exit", "exit_group", "faccessat",
+	"faccessat2", "fadvise64", "fadvise64_64", "fallocate", "fanotify_mark", "fchdir", "fchmod", "fchmodat",
+	"fchmodat2", "fchown", "fchown32", "fchownat", "fcntl", "fcntl64", "fdatasync", "fgetxattr", "flistxattr",
+	"flock", "fork", "fremovexattr", "fsetxattr", "fstat", "fstat64", "fstatat64", "fstatfs", "fstatfs64",
+	"fsync", "ftruncate", "ftruncate64", "futex", "futex_requeue", "futex_time64", "futex_wait", "futex_waitv",
+	"futex_wake", "futimesat", "getcpu", "getcwd", "getdents", "getdents64", "getegid", "getegid32", "geteuid",
+	"geteuid32", "getgid", "getgid32", "getgroups", "getgroups32", "getitimer", "getpeername", "getpgid",
+	"getpgrp", "getpid", "getppid", "getpriority", "getrandom", "getresgid", "getresgid32", "getresuid",
+	"getresuid32", "getrlimit", "get_robust_list", "getrusage", "getsid", "getsockname", "getsockopt",
+	"get_thread_area", "gettid", "gettimeofday", "getuid", "getuid32", "getxattr", "inotify_add_watch",
+	"inotify_init", "inotify_init1", "inotify_rm_watch", "io_cancel", "ioctl", "io_destroy", "io_getevents",
+	"io_pgetevents", "io_pgetevents_time64", "ioprio_get", "ioprio_set", "io_setup", "io_submit", "ipc", "kill",
+	"landlock_add_rule", "landlock_create_ruleset", "landlock_restrict_self", "lchown", "lchown32", "lgetxattr",
+	"link", "linkat", "listen", "listxattr", "llistxattr", "_llseek", "lremovexattr", "lseek", "lsetxattr",
+	"lstat", "lstat64", "madvise", "map_shadow_stack", "membarrier", "memfd_create", "memfd_secret", "mincore",
+	"mkdir", "mkdirat", "mknod", "mknodat", "mlock", "mlock2", "mlockall", "mmap", "mmap2", "mprotect",
+	"mq_getsetattr", "mq_notify", "mq_open", "mq_timedreceive", "mq_timedreceive_time64", "mq_timedsend",
+	"mq_timedsend_time64", "mq_unlink", "mremap", "msgctl", "msgget", "msgrcv", "msgsnd", "msync", "munlock",
+	"munlockall", "munmap", "name_to_handle_at", "nanosleep", "newfstatat", "_newselect", "open", "openat",
+	"openat2", "pause", "pidfd_open", "pidfd_send_signal", "pipe", "pipe2", "pkey_alloc", "pkey_free",
+	"pkey_mprotect", "poll", "ppoll", "ppoll_time64", "prctl", "pread64", "preadv", "preadv2", "prlimit64",
+	"process_mrelease", "pselect6", "pselect6_time64", "pwrite64", "pwritev", "pwritev2", "read", "readahead",
+	"readlink", "readlinkat", "readv", "recv", "recvfrom", "recvmmsg", "recvmmsg_time64", "recvmsg",
+	"remap_file_pages", "removexattr", "rename", "renameat", "renameat2", "restart_syscall", "rmdir", "rseq",
+	"rt_sigaction", "rt_sigpending", "rt_sigprocmask", "rt_sigqueueinfo", "rt_sigreturn", "rt_sigsuspend",
+	"rt_sigtimedwait", "rt_sigtimedwait_time64", "rt_tgsigqueueinfo", "sched_getaffinity", "sched_getattr",
+	"sched_getparam", "sched_get_priority_max", "sched_get_priority_min", "sched_getscheduler",
+	"sched_rr_get_interval", "sched_rr_get_interval_time64", "sched_setaffinity", "sched_setattr",
+	"sched_setparam", "sched_setscheduler", "sched_yield", "seccomp", "select", "semctl", "semget", "semop",
+	"semtimedop", "semtimedop_time64", "send", "sendfile", "sendfile64", "sendmmsg", "sendmsg", "sendto",
+	"setfsgid", "setfsgid32", "setfsuid", "setfsuid32", "setgid", "setgid32", "setgroups", "setgroups32",
+	"setitimer", "setpgid", "setpriority", "setregid", "setregid32", "setresgid", "setresgid32", "setresuid",
+	"setresuid32", "setreuid", "setreuid32", "setrlimit", "set_robust_list", "setsid", "setsockopt",
+	"set_thread_area", "set_tid_address", "setuid", "setuid32", "setxattr", "shmat", "shmctl", "shmdt", "shmget",
+	"shutdown", "sigaltstack", "signalfd", "signalfd4", "sigprocmask", "sigreturn", "socketcall", "socketpair",
+	"splice", "stat", "stat64", "statfs", "statfs64", "statx", "symlink", "symlinkat", "sync", "sync_file_range",
+	"syncfs", "sysinfo", "tee", "tgkill", "time", "timer_create", "timer_delete", "timer_getoverrun",
+	"timer_gettime", "timer_gettime64", "timer_settime", "timer_settime64", "timerfd_create", "timerfd_gettime",
+	"timerfd_gettime64", "timerfd_settime", "timerfd_settime64", "times", "tkill", "truncate", "truncate64",
+	"ugetrlimit", "umask", "uname", "unlink", "unlinkat", "utime", "utimensat", "utimensat_time64", "utimes",
+	"vfork", "vmsplice", "wait4", "waitid", "waitpid", "write", "writev",
+}
+
+// 拥有指定 capability 时放行的 syscall
+var defaultCapabilitySyscalls = map[string][]string{
+	"CAP_DAC_READ_SEARCH": {"open_by_handle_at"},
+	"CAP_SYS_ADMIN": {"bpf", "clone", "clone3", "fanotify_init", "fsconfig", "fsmount", "fsopen", "fspick",
+		"lookup_dcookie", "mount", "mount_setattr", "move_mount", "open_tree", "perf_event_open", "quotactl",
+		"quotactl_fd", "setdomainname", "sethostname", "setns", "syslog", "umount", "umount2", "unshare"},
+	"CAP_SYS_BOOT":       {"reboot"},
+	"CAP_SYS_CHROOT":     {"chroot"},
+	"CAP_SYS_MODULE":     {"delete_module", "init_module", "finit_module"},
+	"CAP_SYS_PACCT":      {"acct"},
+	"CAP_SYS_PTRACE":     {"kcmp", "pidfd_getfd", "process_madvise", "process_vm_readv", "process_vm_writev", "ptrace"},
+	"CAP_SYS_RAWIO":      {"iopl", "ioperm"},
+	"CAP_SYS_TIME":       {"settimeofday", "stime", "clock_settime", "clock_settime64"},
+	"CAP_SYS_TTY_CONFIG": {"vhangup"},
+	"CAP_SYS_NICE":       {"get_mempolicy", "mbind", "set_mempolicy", "set_mempolicy_home_node"},
+	"CAP_SYSLOG":         {"syslog"},
+	"CAP_BPF":            {"bpf"},
+	"CAP_PERFMON":        {"perf_event_open"},
+}
+
+// personality 允许的参数：PER_LINUX、PER_LINUX32、UNAME26、PER_LINUX32|UNAME26、查询当前值
+var defaultPersonalities = []uint64{0x0, 0x8, 0x20000, 0x20008, 0xffffffff}
+
+const (
+	// clone 创建 namespace 的标志位：CLONE_NEWNS|CLONE_NEWUTS|CLONE_NEWIPC|CLONE_NEWUSER|CLONE_NEWPID|CLONE_NEWNET|CLONE_NEWCGROUP
+	cloneNamespaceFlags = 0x7e020000
+	// AF_VSOCK 地址族
+	afVsock = 40
+	// clone3 参数位于用户态内存无法过滤，返回 ENOSYS 让 libc 回退到 clone
+	errnoENOSYS = 38
+)
+
+/**
+ * 生成默认 seccomp 配置
+ */
+func DefaultProfile() *Profile {
+	eperm := uint(1)
+	enosys := uint(errnoENOSYS)
+	profile := &Profile{
+		DefaultAction:   ActErrno,
+		DefaultErrnoRet: &eperm,
+		Syscalls: []*Syscall{
+			{Names: defaultAllowedSyscalls, Action: ActAllow},
+		},
+	}
+	for _, persona := range defaultPersonalities {
+		profile.Syscalls = append(profile.Syscalls, &Syscall{
+			Names:  []string{"personality"},
+			Action: ActAllow,
+			Args:   []*Arg{{Index: 0, Value: persona, Op: OpEqualTo}},
+		})
+	}
+	profile.Syscalls = append(profile.Syscalls,
+		&Syscall{
+			Names:   []string{"socket"},
+			Action:  ActAllow,
+			Args:    []*Arg{{Index: 0, Value: afVsock, Op: OpNotEqual}},
+			Comment: "AF_VSOCK is not namespaced",
+		},
+		&Syscall{
+			Names:    []string{"arch_prctl", "modify_ldt"},
+			Action:   ActAllow,
+			Includes: Filter{Arches: []string{"amd64"}},
+		},
+		&Syscall{
+			Names:    []string{"clone"},
+			Action:   ActAllow,
+			Args:     []*Arg{{Index: 0, Value: cloneNamespaceFlags, ValueTwo: 0, Op: OpMaskedEqual}},
+			Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			Comment:  "creating namespaces requires CAP_SYS_ADMIN",
+		},
+		&Syscall{
+			Names:    []string{"clone3"},
+			Action:   ActErrno,
+			ErrnoRet: &enosys,
+			Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+		},
+	)
+	// 保证生成的过滤规则顺序稳定
+	caps := make([]string, 0, len(defaultCapabilitySyscalls))
+	for cap := range defaultCapabilitySyscalls {
+		caps = append(caps, cap)
+	}
+	sort.Strings(caps)
+	for _, cap := range caps {
+		profile.Syscalls = append(profile.Syscalls, &Syscall{
+			Names:    defaultCapabilitySyscalls[cap],
+			Action:   ActAllow,
+			Includes: Filter{Caps: []string{cap}},
+		})
+	}
+	return profile
+}
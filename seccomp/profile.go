@@ -0,0 +1,182 @@
+package seccomp
+
+import (
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+ * seccomp 配置，兼容 docker/OCI 的 seccomp JSON 格式
+ * Usage: ./Mydocker run --security-opt seccomp=profile.json xxx
+ *        ./Mydocker run --security-opt seccomp=unconfined xxx
+ */
+
+const (
+	// 关闭 syscall 过滤
+	Unconfined = "unconfined"
+	// 内置默认配置
+	DefaultProfileName = "default"
+)
+
+// seccomp 动作
+const (
+	ActKill        = "SCMP_ACT_KILL"
+	ActKillThread  = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        = "SCMP_ACT_TRAP"
+	ActErrno       = "SCMP_ACT_ERRNO"
+	ActTrace       = "SCMP_ACT_TRACE"
+	ActAllow       = "SCMP_ACT_ALLOW"
+	ActLog         = "SCMP_ACT_LOG"
+)
+
+// syscall 参数比较操作
+const (
+	OpNotEqual     = "SCMP_CMP_NE"
+	OpLessThan     = "SCMP_CMP_LT"
+	OpLessEqual    = "SCMP_CMP_LE"
+	OpEqualTo      = "SCMP_CMP_EQ"
+	OpGreaterEqual = "SCMP_CMP_GE"
+	OpGreaterThan  = "SCMP_CMP_GT"
+	OpMaskedEqual  = "SCMP_CMP_MASKED_EQ"
+)
+
+/**
+ * seccomp 配置文件
+ */
+type Profile struct {
+	DefaultAction   string     `json:"defaultAction"`
+	DefaultErrnoRet *uint      `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string   `json:"architectures,omitempty"`
+	ArchMap         []ArchMap  `json:"archMap,omitempty"`
+	Syscalls        []*Syscall `json:"syscalls"`
+}
+
+/**
+ * docker 格式中主架构与兼容架构的对应关系
+ */
+type ArchMap struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures"`
+}
+
+/**
+ * syscall 过滤规则，includes/excludes 为 docker 扩展，按容器 capability 和架构决定规则是否生效
+ */
+type Syscall struct {
+	Name     string   `json:"name,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Action   string   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args,omitempty"`
+	Comment  string   `json:"comment,omitempty"`
+	Includes Filter   `json:"includes,omitempty"`
+	Excludes Filter   `json:"excludes,omitempty"`
+}
+
+/**
+ * syscall 参数条件，Index 为参数序号
+ */
+type Arg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+/**
+ * 规则生效条件
+ */
+type Filter struct {
+	Caps   []string `json:"caps,omitempty"`
+	Arches []string `json:"arches,omitempty"`
+}
+
+/**
+ * 加载 seccomp JSON 配置文件
+ */
+func LoadProfile(path string) (*Profile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, meta.NewError(meta.ErrRead, fmt.Sprintf("read seccomp profile %s failed", path), err)
+	}
+	profile := new(Profile)
+	if err := json.Unmarshal(content, profile); err != nil {
+		return nil, meta.NewError(meta.ErrConvert, fmt.Sprintf("unmarshal seccomp profile %s failed", path), err)
+	}
+	if profile.DefaultAction == "" {
+		return nil, meta.NewError(meta.ErrInvalidParam, fmt.Sprintf("seccomp profile %s missing defaultAction", path), nil)
+	}
+	return profile, nil
+}
+
+/**
+ * 根据 --security-opt seccomp=xxx 的值获取配置，unconfined 返回 nil
+ */
+func GetProfile(opt string) (*Profile, error) {
+	switch opt {
+	case "", DefaultProfileName:
+		return DefaultProfile(), nil
+	case Unconfined:
+		return nil, nil
+	default:
+		return LoadProfile(opt)
+	}
+}
+
+/**
+ * 规则是否对当前容器生效
+ * 1.includes 中的 capability 必须全部拥有，架构必须匹配；
+ * 2.excludes 中的 capability 拥有任意一个即排除，架构匹配即排除；
+ */
+func (s *Syscall) enabled(caps map[string]bool) bool {
+	for _, c := range s.Includes.Caps {
+		if !caps[strings.ToUpper(c)] {
+			return false
+		}
+	}
+	if len(s.Includes.Arches) > 0 && !matchArch(s.Includes.Arches) {
+		return false
+	}
+	for _, c := range s.Excludes.Caps {
+		if caps[strings.ToUpper(c)] {
+			return false
+		}
+	}
+	if len(s.Excludes.Arches) > 0 && matchArch(s.Excludes.Arches) {
+		return false
+	}
+	return true
+}
+
+/**
+ * docker 使用 amd64/arm64 等短名称，OCI 使用 SCMP_ARCH_X86_64 等名称
+ */
+func matchArch(arches []string) bool {
+	aliases := map[string]string{
+		"amd64": "SCMP_ARCH_X86_64",
+		"arm64": "SCMP_ARCH_AARCH64",
+	}
+	for _, arch := range arches {
+		if alias, ok := aliases[arch]; ok {
+			arch = alias
+		}
+		if arch == nativeArch {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * 规则包含的 syscall 名称
+ */
+func (s *Syscall) names() []string {
+	if s.Name != "" {
+		return append([]string{s.Name}, s.Names...)
+	}
+	return s.Names
+}
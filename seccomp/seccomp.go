@@ -0,0 +1,40 @@
+package seccomp
+
+import (
+	"Mydockker/meta"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// linux/seccomp.h
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+)
+
+/**
+ * 安装 seccomp 过滤器，必须是 execve 之前的最后一步
+ * 1.锁定当前线程，保证 execve 在安装过滤器的线程上执行；
+ * 2.设置 no_new_privs，禁止 execve 提升权限，同时允许无 CAP_SYS_ADMIN 时安装过滤器；
+ * 3.SECCOMP_FILTER_FLAG_TSYNC 同步过滤器到 go runtime 的所有线程；
+ */
+func InitSeccomp(filter []unix.SockFilter) error {
+	if len(filter) == 0 {
+		return nil
+	}
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return meta.NewError(meta.ErrWrite, "set no_new_privs failed", err)
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return meta.NewError(meta.ErrWrite, "install seccomp filter failed", errno)
+	}
+	return nil
+}
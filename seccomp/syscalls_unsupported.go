@@ -0,0 +1,11 @@
+//go:build linux && !amd64 && !arm64
+
+package seccomp
+
+const (
+	nativeArch      = ""
+	nativeAuditArch = 0
+)
+
+// 当前架构没有 syscall 编号表，只支持 unconfined
+var syscallTable = map[string]uint32{}
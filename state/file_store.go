@@ -0,0 +1,218 @@
+package state
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+/**
+ * 基于文件的状态存储
+ * 1.每个容器一个目录 <root>/<name>/，记录为 config.json，目录下还有 hosts 等容器状态文件；
+ * 2.写入先写临时文件再 rename，读到的总是完整的记录；
+ * 3.<root>/<name>/.lock 是容器锁，串行化同一容器的 Update；
+ * 4.<root>/.lock 是全局锁，串行化容器名的占用和释放；
+ */
+type FileStore struct {
+	root string
+}
+
+const lockFileName = ".lock"
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+func (s *FileStore) dir(name string) string {
+	return filepath.Join(s.root, name)
+}
+
+func (s *FileStore) configPath(name string) string {
+	return filepath.Join(s.dir(name), container.ConfigName)
+}
+
+func (s *FileStore) Get(name string) (*container.Info, error) {
+	content, err := ioutil.ReadFile(s.configPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.STATE), fmt.Sprintf("no such container: %s", name), err)
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.STATE), fmt.Sprintf("read state of container %s failed", name), err)
+	}
+	info := new(container.Info)
+	if err := json.Unmarshal(content, info); err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.STATE), fmt.Sprintf("unmarshal state of container %s failed", name), err)
+	}
+	return info, nil
+}
+
+/**
+ * 列出所有容器，跳过正在创建或删除、还没有记录的目录
+ */
+func (s *FileStore) List() ([]*container.Info, error) {
+	entries, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.STATE), fmt.Sprintf("read state dir %s failed", s.root), err)
+	}
+	infos := make([]*container.Info, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := s.Get(entry.Name())
+		if err != nil {
+			if !IsNotFound(err) {
+				return nil, err
+			}
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+/**
+ * 占用容器名并写入第一版记录
+ */
+func (s *FileStore) Create(info *container.Info) error {
+	unlock, err := s.lockGlobal()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(s.configPath(info.Name)); err == nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrExists, meta.STATE), fmt.Sprintf("container name %s is already in use", info.Name), nil)
+	}
+	if err := os.MkdirAll(s.dir(info.Name), container.Perm0755); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("create state dir of container %s failed", info.Name), err)
+	}
+	info.Revision = 1
+	return s.write(info)
+}
+
+/**
+ * compare-and-swap：只有记录仍是 info.Revision 时才写入
+ */
+func (s *FileStore) Update(info *container.Info) error {
+	unlock, err := s.lockContainer(info.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := s.Get(info.Name)
+	if err != nil {
+		return err
+	}
+	if current.Revision != info.Revision {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConflict, meta.STATE), fmt.Sprintf("container %s was modified concurrently, revision %d, expected %d", info.Name, current.Revision, info.Revision), nil)
+	}
+	info.Revision++
+	if err := s.write(info); err != nil {
+		info.Revision--
+		return err
+	}
+	return nil
+}
+
+/**
+ * 删除容器记录及其状态目录，释放容器名
+ */
+func (s *FileStore) Delete(name string) error {
+	unlock, err := s.lockGlobal()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	unlockContainer, err := s.lockContainer(name)
+	if err != nil {
+		return err
+	}
+	defer unlockContainer()
+	if err := os.RemoveAll(s.dir(name)); err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("remove state of container %s failed", name), err)
+	}
+	return nil
+}
+
+/**
+ * 写临时文件、fsync 后 rename 覆盖记录
+ */
+func (s *FileStore) write(info *container.Info) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrConvert, meta.STATE), fmt.Sprintf("marshal state of container %s failed", info.Name), err)
+	}
+	tmp, err := ioutil.TempFile(s.dir(info.Name), "."+container.ConfigName+".")
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("create state of container %s failed", info.Name), err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), container.Perm0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.configPath(info.Name))
+	}
+	if err != nil {
+		return meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("write state of container %s failed", info.Name), err)
+	}
+	return nil
+}
+
+func (s *FileStore) lockGlobal() (func(), error) {
+	if err := os.MkdirAll(s.root, container.Perm0755); err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("create state dir %s failed", s.root), err)
+	}
+	return lockFile(filepath.Join(s.root, lockFileName))
+}
+
+func (s *FileStore) lockContainer(name string) (func(), error) {
+	if _, err := os.Stat(s.dir(name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, meta.NewError(meta.NewErrorCode(meta.ErrNotFound, meta.STATE), fmt.Sprintf("no such container: %s", name), err)
+		}
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrRead, meta.STATE), fmt.Sprintf("stat state of container %s failed", name), err)
+	}
+	return lockFile(filepath.Join(s.dir(name), lockFileName))
+}
+
+/**
+ * flock 排他锁，返回解锁函数，进程退出时内核自动释放
+ */
+func lockFile(path string) (func(), error) {
+	fd, err := unix.Open(path, unix.O_CREAT|unix.O_RDWR|unix.O_CLOEXEC, container.Perm0644)
+	if err != nil {
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("open lock %s failed", path), err)
+	}
+	for {
+		err = unix.Flock(fd, unix.LOCK_EX)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, meta.NewError(meta.NewErrorCode(meta.ErrWrite, meta.STATE), fmt.Sprintf("lock %s failed", path), err)
+	}
+	return func() {
+		unix.Flock(fd, unix.LOCK_UN)
+		unix.Close(fd)
+	}, nil
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"Mydockker/container"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	info := &container.Info{Id: "0123456789", Name: "web", Status: container.CREATED}
+	if err := store.Create(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(&container.Info{Name: "web"}); !IsExists(err) {
+		t.Fatalf("expected name in use, got %v", err)
+	}
+	// stale revision is rejected
+	stale, err := store.Get("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Status = container.RUNNING
+	if err := store.Update(info); err != nil {
+		t.Fatal(err)
+	}
+	stale.Status = container.STOP
+	if err := store.Update(stale); !IsConflict(err) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if got, _ := store.Get("web"); got.Status != container.RUNNING || got.Revision != 2 {
+		t.Fatalf("unexpected record %+v", got)
+	}
+	infos, err := store.List()
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("unexpected list %v %v", infos, err)
+	}
+	if err := store.Delete("web"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("web"); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := store.Update(info); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestModifyConcurrently(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	if err := store.Create(&container.Info{Name: "web", Pid: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Modify(store, "web", func(info *container.Info) error {
+				n, _ := strconv.Atoi(info.Pid)
+				info.Pid = strconv.Itoa(n + 1)
+				return nil
+			})
+			if err != nil && !IsConflict(err) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	info, err := store.Get("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every successful modification is kept, none is lost
+	if n, _ := strconv.Atoi(info.Pid); uint64(n) != info.Revision-1 {
+		t.Fatalf("lost update: pid %s revision %d", info.Pid, info.Revision)
+	}
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"Mydockker/container"
+	"Mydockker/meta"
+)
+
+/**
+ * 容器状态存储
+ * 1.Create 在全局锁下占用容器名，同名容器已存在时返回 ErrExists；
+ * 2.Update 是 compare-and-swap：记录的 Revision 与传入的不一致时返回 ErrConflict，成功后 Revision 加一；
+ * 3.Get、List 读取的都是完整写入的记录，不会读到写了一半的文件；
+ * Usage:
+ *   store := state.NewFileStore(paths.StateRoot())
+ *   err := state.Modify(store, name, func(info *container.Info) error { info.Status = container.STOP; return nil })
+ */
+type Store interface {
+	Get(name string) (*container.Info, error)
+	List() ([]*container.Info, error)
+	Create(info *container.Info) error
+	Update(info *container.Info) error
+	Delete(name string) error
+}
+
+// Modify 遇到并发修改时的最大重试次数
+const maxModifyRetries = 10
+
+/**
+ * 读取-修改-写回，并发修改导致 compare-and-swap 失败时重新读取再修改
+ */
+func Modify(store Store, name string, fn func(info *container.Info) error) (*container.Info, error) {
+	var err error
+	for i := 0; i < maxModifyRetries; i++ {
+		var info *container.Info
+		if info, err = store.Get(name); err != nil {
+			return nil, err
+		}
+		if err = fn(info); err != nil {
+			return nil, err
+		}
+		if err = store.Update(info); err == nil {
+			return info, nil
+		}
+		if !IsConflict(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func IsNotFound(err error) bool {
+	return meta.HasBehavior(err, meta.ErrNotFound)
+}
+
+func IsExists(err error) bool {
+	return meta.HasBehavior(err, meta.ErrExists)
+}
+
+func IsConflict(err error) bool {
+	return meta.HasBehavior(err, meta.ErrConflict)
+}
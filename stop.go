@@ -1,25 +1,29 @@
 package main
 
 import (
+	"Mydockker/cgroups"
 	"Mydockker/container"
-	"Mydockker/meta"
-	"encoding/json"
+	"Mydockker/events"
+	"Mydockker/state"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func StopContainer(containerName string) {
+func StopContainer(containerRef string) {
 	// get pid of containerProcess
-	info, err := getContainerInfoByName(containerName)
+	info, err := resolveContainer(containerRef)
 	if err != nil {
-		log.Errorf("Get containerInfo %s failed %v", containerName, err)
+		log.Errorf("Get containerInfo %s failed %v", containerRef, err)
 		return
 	}
+	containerName := info.Name
 	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
 		log.Errorf("Convert containerPid %s failed %v", containerName, err)
@@ -30,55 +34,250 @@ func StopContainer(containerName string) {
 		log.Errorf("Send SIGTERM to %s failed %v", containerName, err)
 		return
 	}
-	// update and cleanup containerStatus
-	info.Status = container.STOP
-	info.Pid = " "
-	content, err := json.Marshal(info)
+	eventJournal().LogContainer(events.ActionKill, info, map[string]string{"signal": strconv.Itoa(int(syscall.SIGTERM))})
+	// wait for init process to exit, SIGKILL it if SIGTERM is ignored
+	for i := 0; i < killWaitTimes && info.IsAlive(); i++ {
+		time.Sleep(killWaitPeriod)
+	}
+	var stopped *container.Info
+	if info.IsAlive() {
+		log.Warnf("Container %s is still running after SIGTERM, killing it", containerName)
+		stopped, err = killContainer(info)
+	} else {
+		stopped, err = markStopped(info, exitCodeUnknown)
+	}
 	if err != nil {
-		log.Errorf("Json marshal %s failed %v", containerName, err)
+		if !state.IsNotFound(err) {
+			log.Errorf("Update state of %s failed %v", containerName, err)
+		}
 		return
 	}
-	dirUrl := fmt.Sprintf(container.JsonFormat, containerName)
-	configPath := dirUrl + container.ConfigName
-	if err := ioutil.WriteFile(configPath, content, container.Perm0622); err != nil {
-		log.Errorf("Write file %s failed %v", configPath, err)
-	}
+	eventJournal().LogContainer(events.ActionStop, stopped, nil)
 }
 
 /**
  * get containerInfo by containerName
  */
 func getContainerInfoByName(containerName string) (*container.Info, error) {
-	dirUrl := fmt.Sprintf(container.JsonFormat, containerName)
-	configFilePath := dirUrl + container.ConfigName
-	content, err := ioutil.ReadFile(configFilePath)
-	if err != nil {
-		return nil, meta.NewError(meta.ErrRead, "Read configFile failed", err)
+	return containerStore().Get(containerName)
+}
+
+/**
+ * get containerInfo by full id, name or unique id prefix
+ */
+func resolveContainer(containerRef string) (*container.Info, error) {
+	return container.MatchContainer(loadContainerInfos(), containerRef)
+}
+
+/**
+ * remove containers, each removal is independent, the ones failed are reported at last
+ * Usage: ./Mydocker rm -f -v web db
+ */
+func RemoveContainers(containerRefs []string, force, removeVolumes bool) error {
+	var failed []string
+	for _, containerRef := range containerRefs {
+		info, err := resolveContainer(containerRef)
+		if err == nil {
+			err = removeContainer(info, force, removeVolumes)
+		}
+		if err != nil {
+			log.Errorf("Remove container %s failed %v", containerRef, err)
+			failed = append(failed, containerRef)
+			continue
+		}
+		fmt.Println(containerRef)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove containers: %v", failed)
+	}
+	return nil
+}
+
+/**
+ * remove container and every resource it owns
+ * 1.running container is killed first when force is set, otherwise refused;
+ * 2.network endpoint: port mappings, veth device, ip and hosts entry;
+ * 3.cgroup unless still used by other running containers;
+ * 4.workspace, and host directory of volume when removeVolumes is set;
+ * 5.logs directory and container record, record is removed last so that a failed removal can be retried;
+ */
+func removeContainer(info *container.Info, force, removeVolumes bool) error {
+	containerName := info.Name
+	if pod := podOfInfraContainer(containerName); pod != "" {
+		return fmt.Errorf("container %s is the infra container of pod %s, remove the pod instead", containerName, pod)
+	}
+	// containers sharing namespaces of this container must stop first
+	if dependents := getDependentContainers(containerName); len(dependents) > 0 {
+		return fmt.Errorf("Can't remove container %s, namespaces are shared by running containers %v", containerName, dependents)
+	}
+	if info.Status != container.STOP && info.Status != container.Exit {
+		if !force {
+			return fmt.Errorf("You cannot remove a %s container %s. Stop the container before attempting removal or force remove", info.Status, containerName)
+		}
+		var err error
+		if info, err = killContainer(info); err != nil {
+			// tty container is removed by its mydocker run once killed
+			if state.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := releaseNetworkEndpoint(info); err != nil {
+		log.Warnf("Release network endpoint of %s failed %v", containerName, err)
 	}
-	var info container.Info
-	if err = json.Unmarshal(content, &info); err != nil {
-		return nil, meta.NewError(meta.ErrRead, "Unmarshal containerInfo failed", err)
+	if info.CgroupPath != "" && !cgroupInUse(info) {
+		if err := cgroups.NewManager(info.CgroupPath).Destory(); err != nil {
+			log.Warnf("Remove cgroup %s of %s failed %v", info.CgroupPath, containerName, err)
+		}
 	}
-	return &info, nil
+	if err := container.CleanWorkSpace(containerPaths(), containerName); err != nil {
+		return err
+	}
+	if removeVolumes {
+		removeContainerVolumes(info)
+	}
+	if err := os.RemoveAll(containerPaths().LogDir(containerName)); err != nil {
+		log.Warnf("Remove logs of %s failed %v", containerName, err)
+	}
+	if err := containerStore().Delete(containerName); err != nil && !state.IsNotFound(err) {
+		return fmt.Errorf("Remove containerInfo %s failed %v", containerName, err)
+	}
+	eventJournal().LogContainer(events.ActionDestroy, info, nil)
+	return nil
 }
 
 /**
- * remove unused container
+ * kill init process of container, wait until it's gone and mark container stopped
  */
-func RemoveContainer(containerName string) {
-	info, err := getContainerInfoByName(containerName)
+func killContainer(info *container.Info) (*container.Info, error) {
+	containerName := info.Name
+	if pid, err := strconv.Atoi(strings.TrimSpace(info.Pid)); err == nil && info.IsAlive() {
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return nil, fmt.Errorf("Send SIGKILL to %s failed %v", containerName, err)
+		}
+		eventJournal().LogContainer(events.ActionKill, info, map[string]string{"signal": strconv.Itoa(int(syscall.SIGKILL))})
+		for i := 0; i < killWaitTimes && info.IsAlive(); i++ {
+			time.Sleep(killWaitPeriod)
+		}
+		if info.IsAlive() {
+			return nil, fmt.Errorf("container %s is still running after SIGKILL", containerName)
+		}
+	}
+	return markStopped(info, exitCodeKilled)
+}
+
+/**
+ * mark an exited container stopped
+ * the monitor of the container records exit code and die event and releases network endpoint, wait for it to exit first;
+ * without a monitor, e.g. it has been killed, it's done here and exitCodeUnknown records no exit code
+ */
+func markStopped(info *container.Info, exitCode int) (*container.Info, error) {
+	for i := 0; i < killWaitTimes && info.IsMonitored(); i++ {
+		time.Sleep(killWaitPeriod)
+	}
+	recorded := true
+	stopped, err := state.Modify(containerStore(), info.Name, func(current *container.Info) error {
+		if current.Status == container.RUNNING {
+			recorded = false
+			current.Pid = " "
+			current.FinishedAt = time.Now().Format(timeLayout)
+			if exitCode != exitCodeUnknown {
+				current.ExitCode = exitCode
+			}
+		}
+		current.Status = container.STOP
+		return nil
+	})
 	if err != nil {
-		log.Errorf("Get container %s info failed %v", containerName, err)
-		return
+		return nil, err
 	}
-	if info.Status != container.STOP {
-		log.Errorf("Can't remove running container")
-		return
+	if !recorded {
+		var attributes map[string]string
+		if exitCode != exitCodeUnknown {
+			attributes = map[string]string{"exitCode": strconv.Itoa(exitCode)}
+		}
+		eventJournal().LogContainer(events.ActionDie, stopped, attributes)
+		if err := releaseNetworkEndpoint(stopped); err != nil {
+			log.Warnf("Release network endpoint of %s failed %v", info.Name, err)
+		} else {
+			stopped.NetworkSettings = container.NetworkSettings{Network: stopped.NetworkSettings.Network}
+		}
 	}
-	dirUrl := fmt.Sprintf(container.JsonFormat, containerName)
-	if err := os.RemoveAll(dirUrl); err != nil {
-		log.Errorf("Remove containerInfoFile %s failed", containerName)
-		return
+	return stopped, nil
+}
+
+const (
+	killWaitPeriod = 100 * time.Millisecond
+	killWaitTimes  = 100
+	// 128 + SIGKILL
+	exitCodeKilled = 137
+	// exit code of a container stopped without monitor, e.g. after SIGTERM
+	exitCodeUnknown = -1
+)
+
+/**
+ * cgroup is shared by containers outside pods
+ */
+func cgroupInUse(info *container.Info) bool {
+	for _, other := range loadContainerInfos() {
+		if other.Name != info.Name && other.Status == container.RUNNING && other.CgroupPath == info.CgroupPath {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * remove host directories of container's volumes which are created by mydocker and not used by other containers
+ */
+func removeContainerVolumes(info *container.Info) {
+	for _, m := range info.Mounts {
+		// host directories passed by user are never removed, only those created by mydocker
+		if m.Type != "bind" || !m.Created {
+			continue
+		}
+		source := filepath.Clean(m.Source)
+		if source == "/" {
+			continue
+		}
+		if volume, err := inspectVolume(source); err == nil && len(volume.Containers) > 1 {
+			log.Warnf("Volume %s of %s is used by other containers, keep it", source, info.Name)
+			continue
+		}
+		if err := os.RemoveAll(source); err != nil {
+			log.Warnf("Remove volume %s of %s failed %v", source, info.Name, err)
+		}
+	}
+}
+
+/**
+ * name of the pod whose infra container is containerName
+ */
+func podOfInfraContainer(containerName string) string {
+	for _, pod := range loadPods() {
+		if pod.InfraContainer == containerName {
+			return pod.Name
+		}
+	}
+	return ""
+}
+
+/**
+ * get running containers which join namespaces of containerName
+ */
+func getDependentContainers(containerName string) []string {
+	var dependents []string
+	for _, info := range loadContainerInfos() {
+		if info.Status != container.RUNNING || info.Namespaces == nil {
+			continue
+		}
+		for _, name := range info.Namespaces.Dependencies() {
+			if name == containerName {
+				dependents = append(dependents, info.Name)
+				break
+			}
+		}
 	}
-	container.DeleteWorkSpace(info.Volume, containerName)
+	return dependents
 }
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"Mydockker/container"
+	"Mydockker/events"
+	"Mydockker/network"
+	"Mydockker/state"
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errNotDead skips the update of a container which turns out to be alive
+var errNotDead = errors.New("container is alive")
+
+// errNotRunning skips the update of a container whose exit has been recorded
+var errNotRunning = errors.New("container is not running")
+
+/**
+ * reconcile recorded state with the host, runs before every user command
+ * a running container whose init process is gone, or whose pid now belongs to another process after a reboot,
+ * is marked exited and the network endpoint it holds is released
+ * returns records of containers marked exited as they were before
+ */
+func reconcileContainers() []*container.Info {
+	var dead []*container.Info
+	for _, info := range loadContainerInfos() {
+		// exit of a monitored container is recorded by its monitor with exit code
+		if info.Status != container.RUNNING || info.IsAlive() || info.IsMonitored() {
+			continue
+		}
+		updated, err := state.Modify(containerStore(), info.Name, func(current *container.Info) error {
+			if current.Status != container.RUNNING || current.IsAlive() || current.IsMonitored() {
+				return errNotDead
+			}
+			current.Status = container.Exit
+			current.Pid = " "
+			current.FinishedAt = time.Now().Format(timeLayout)
+			return nil
+		})
+		if err != nil {
+			if err != errNotDead {
+				log.Warnf("mark container %s exited failed %v", info.Name, err)
+			}
+			continue
+		}
+		log.Warnf("process %s of container %s is gone, marked exited", info.Pid, info.Name)
+		// exit code is unknown once both init process and its monitor are gone
+		eventJournal().LogContainer(events.ActionDie, updated, nil)
+		if err := releaseNetworkEndpoint(updated); err != nil {
+			log.Warnf("release network endpoint of container %s failed %v", info.Name, err)
+		}
+		dead = append(dead, info)
+	}
+	return dead
+}
+
+/**
+ * release network endpoint held by a container that is no longer running
+ * the endpoint is forgotten afterwards so that its ip is never released twice
+ */
+func releaseNetworkEndpoint(info *container.Info) error {
+	if container.IsRootless() {
+		if info.NetworkSettings.Network == "" {
+			return nil
+		}
+		if err := network.DisconnectSlirp(containerPaths(), info.Name); err != nil {
+			return err
+		}
+	} else {
+		if info.NetworkSettings.EndpointID == "" {
+			return nil
+		}
+		if err := initNetwork(); err != nil {
+			return err
+		}
+		if err := network.Disconnect(containerPaths(), info); err != nil {
+			return err
+		}
+	}
+	eventJournal().LogNetwork(events.ActionDisconnect, info.NetworkSettings.Network, info)
+	_, err := state.Modify(containerStore(), info.Name, func(current *container.Info) error {
+		current.NetworkSettings = container.NetworkSettings{Network: current.NetworkSettings.Network}
+		return nil
+	})
+	return err
+}
+
+/**
+ * resource left behind without any container owning it
+ */
+type leakedResource struct {
+	kind    string
+	name    string
+	release func() error
+}
+
+/**
+ * find leaked resources:
+ * 1.container workspaces and log directories without container record;
+ * 2.ips, veth devices and port mapping rules not used by any running container;
+ */
+func findLeaks() ([]*leakedResource, error) {
+	infos := loadContainerInfos()
+	recorded := map[string]bool{}
+	var endpoints []container.NetworkSettings
+	for _, info := range infos {
+		recorded[info.Name] = true
+		if info.Status == container.RUNNING && info.NetworkSettings.EndpointID != "" {
+			endpoints = append(endpoints, info.NetworkSettings)
+		}
+	}
+	var leaks []*leakedResource
+	workspaces, err := container.ListWorkSpaces(containerPaths())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range workspaces {
+		if !recorded[name] {
+			name := name
+			leaks = append(leaks, &leakedResource{kind: "workspace", name: name, release: func() error {
+				return container.CleanWorkSpace(containerPaths(), name)
+			}})
+		}
+	}
+	logDirs, err := ioutil.ReadDir(containerPaths().LogRoot())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, dir := range logDirs {
+		if dir.IsDir() && !recorded[dir.Name()] {
+			logDir := path.Join(containerPaths().LogRoot(), dir.Name())
+			leaks = append(leaks, &leakedResource{kind: "logs", name: logDir, release: func() error {
+				return os.RemoveAll(logDir)
+			}})
+		}
+	}
+	// bridge networks need root
+	if container.IsRootless() {
+		return leaks, nil
+	}
+	if err := initNetwork(); err != nil {
+		return nil, err
+	}
+	networkLeaks, err := network.FindLeaks(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	for _, leak := range networkLeaks {
+		leaks = append(leaks, &leakedResource{kind: leak.Kind, name: fmt.Sprintf("%s (network %s)", leak.Resource, leak.Network), release: leak.Release})
+	}
+	return leaks, nil
+}
+
+/**
+ * Usage: ./Mydocker system check
+ * reconcile container state and report leaked resources, nothing but the status of dead containers is changed
+ */
+func SystemCheck() error {
+	dead := reconcileContainers()
+	for _, info := range dead {
+		fmt.Printf("container %s: process %s is gone, marked exited\n", info.Name, info.Pid)
+	}
+	leaks, err := findLeaks()
+	if err != nil {
+		return err
+	}
+	for _, leak := range leaks {
+		fmt.Printf("leaked %s: %s\n", leak.kind, leak.name)
+	}
+	if len(dead) == 0 && len(leaks) == 0 {
+		fmt.Println("no problem found")
+	} else if len(leaks) > 0 {
+		fmt.Println("run `mydocker system prune` to release leaked resources")
+	}
+	return nil
+}
+
+const pruneWarning = `WARNING! This will remove:
+  - all stopped containers
+  - all networks not used by at least one container
+  - all dangling images
+  - all leaked workspaces, logs, ips, veth devices and port mapping rules
+Are you sure you want to continue? [y/N] `
+
+/**
+ * Usage: ./Mydocker system prune [-f]
+ * remove stopped containers, unused networks, dangling images and leaked resources
+ * containers of pods are kept, pod rm removes them with their pod
+ */
+func SystemPrune(force bool) error {
+	if !force {
+		fmt.Print(pruneWarning)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return nil
+		}
+	}
+	reconcileContainers()
+	var removed []string
+	infraContainers := map[string]bool{}
+	for _, pod := range loadPods() {
+		infraContainers[pod.InfraContainer] = true
+	}
+	for _, info := range loadContainerInfos() {
+		if (info.Status != container.STOP && info.Status != container.Exit) || infraContainers[info.Name] {
+			continue
+		}
+		if err := removeContainer(info, false, false); err != nil {
+			log.Warnf("remove container %s failed %v", info.Name, err)
+			continue
+		}
+		removed = append(removed, info.Name)
+	}
+	printPruned("Deleted Containers:", removed)
+
+	removed = nil
+	if !container.IsRootless() {
+		if err := initNetwork(); err != nil {
+			return err
+		}
+		used := map[string]bool{globalConfig.DefaultNetwork: true}
+		for _, info := range loadContainerInfos() {
+			used[info.NetworkSettings.Network] = true
+		}
+		for _, pod := range loadPods() {
+			used[pod.Network] = true
+		}
+		for _, name := range network.Names() {
+			if used[name] {
+				continue
+			}
+			if err := network.DeleteNetwork(name); err != nil {
+				log.Warnf("remove network %s failed %v", name, err)
+				continue
+			}
+			eventJournal().LogNetwork(events.ActionDestroy, name, nil)
+			removed = append(removed, name)
+		}
+	}
+	printPruned("Deleted Networks:", removed)
+
+	removed = nil
+	images, err := container.DanglingImages(containerPaths())
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if err := os.Remove(image); err != nil {
+			log.Warnf("remove dangling image %s failed %v", image, err)
+			continue
+		}
+		removed = append(removed, image)
+		eventJournal().Log(events.TypeImage, events.ActionDelete, image, nil)
+	}
+	printPruned("Deleted Images:", removed)
+
+	removed = nil
+	leaks, err := findLeaks()
+	if err != nil {
+		return err
+	}
+	for _, leak := range leaks {
+		if err := leak.release(); err != nil {
+			log.Warnf("release leaked %s %s failed %v", leak.kind, leak.name, err)
+			continue
+		}
+		removed = append(removed, leak.kind+" "+leak.name)
+	}
+	printPruned("Released Resources:", removed)
+	return nil
+}
+
+func printPruned(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Println(title)
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	fmt.Println()
+}
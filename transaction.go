@@ -0,0 +1,39 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * undo actions of a multi-step operation
+ * each successful step registers how to undo itself, rollback undoes them in reverse order
+ * Usage:
+ *   tx := &transaction{}
+ *   defer func() { if err != nil { tx.rollback() } }()
+ *   tx.onRollback("delete workspace", func() error { return container.DeleteWorkSpace(containerPaths(), volume, name) })
+ */
+type transaction struct {
+	steps []undoStep
+}
+
+type undoStep struct {
+	name string
+	undo func() error
+}
+
+func (tx *transaction) onRollback(name string, undo func() error) {
+	tx.steps = append(tx.steps, undoStep{name: name, undo: undo})
+}
+
+/**
+ * undo all registered steps in reverse order, failure of one step doesn't stop the others
+ */
+func (tx *transaction) rollback() {
+	for i := len(tx.steps) - 1; i >= 0; i-- {
+		step := tx.steps[i]
+		if err := step.undo(); err != nil {
+			log.Warnf("rollback %s failed %v", step.name, err)
+		}
+	}
+	tx.steps = nil
+}